@@ -0,0 +1,45 @@
+// cmd/rotate-keys/main.go
+package main
+
+import (
+	"hej/internal/auth"
+	"hej/internal/config"
+	"log"
+
+	"github.com/joho/godotenv"
+)
+
+// rotate-keys re-encrypts every stored token record under the primary key.
+// Run it offline, after adding the new key to TOKEN_ENCRYPTION_KEYS and making it
+// the primary key; once it finishes, the old keys can be removed from the configuration.
+func main() {
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: No .env file found")
+	}
+
+	cfg := config.LoadConfig()
+	if cfg.TokenStorePath == "" {
+		log.Fatal("TOKEN_STORE_PATH is not set")
+	}
+	if cfg.TokenEncryptionKeys == "" {
+		log.Fatal("TOKEN_ENCRYPTION_KEYS is not set")
+	}
+
+	keyring, err := auth.ParseKeyring(cfg.TokenEncryptionKeys, cfg.TokenEncryptionKeyID)
+	if err != nil {
+		log.Fatalf("Invalid token encryption keys: %v", err)
+	}
+
+	backend, err := auth.NewFileBackend(cfg.TokenStorePath)
+	if err != nil {
+		log.Fatalf("Failed to open token store: %v", err)
+	}
+
+	rewritten, err := auth.ReEncrypt(backend, keyring)
+	if err != nil {
+		log.Fatalf("Re-encryption stopped after %d records: %v", rewritten, err)
+	}
+
+	log.Printf("Re-encrypted %d records under key %q", rewritten, keyring.PrimaryKeyID())
+}
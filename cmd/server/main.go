@@ -16,7 +16,10 @@ func main() {
 	}
 
 	// Create and start the server
-	srv := server.NewServer()
+	srv, err := server.NewServer()
+	if err != nil {
+		log.Fatalf("Failed to create server: %v", err)
+	}
 	if err := srv.Start(); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 		os.Exit(1)
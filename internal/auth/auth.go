@@ -4,31 +4,171 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"net/http"
 
 	"golang.org/x/oauth2"
 )
 
 // OAuthService provides common OAuth functionality
 type OAuthService struct {
-	config *oauth2.Config
+	provider string
+	config   *oauth2.Config
+	states   *StateStore
+	tokens   *TokenStore
+	pkce     bool
+	client   *http.Client // used for token exchanges and refreshes, oauth2's default when nil
 }
 
-// NewOAuthService creates a new OAuth service
-func NewOAuthService(config *oauth2.Config) *OAuthService {
+// NewOAuthService creates a new OAuth service for the named provider
+func NewOAuthService(provider string, config *oauth2.Config) *OAuthService {
 	return &OAuthService{
-		config: config,
+		provider: provider,
+		config:   config,
+		states:   defaultStates,
+		tokens:   defaultTokens,
 	}
 }
 
-// GetAuthURL returns the OAuth URL for authentication
-func (s *OAuthService) GetAuthURL() string {
-	state := generateRandomState()
-	return s.config.AuthCodeURL(state)
+// EnablePKCE turns on PKCE (S256) for every login started by this service.
+// Providers that require it, and public clients without a secret, must enable it.
+func (s *OAuthService) EnablePKCE() {
+	s.pkce = true
 }
 
-// ExchangeCode exchanges an authorization code for a token
-func (s *OAuthService) ExchangeCode(code string) (*oauth2.Token, error) {
-	return s.config.Exchange(context.Background(), code)
+// SetHTTPClient sets the HTTP client used to exchange and refresh tokens with the provider
+func (s *OAuthService) SetHTTPClient(client *http.Client) {
+	s.client = client
+}
+
+// GetAuthURL returns the OAuth URL for authentication and the state it was issued with.
+// The login options are carried inside the signed state.
+func (s *OAuthService) GetAuthURL(opts LoginOptions) (string, string) {
+	entry := State{
+		LoginOptions: opts,
+		Provider:     s.provider,
+	}
+
+	var authOpts []oauth2.AuthCodeOption
+	if s.pkce {
+		entry.Verifier = oauth2.GenerateVerifier()
+		authOpts = append(authOpts, oauth2.S256ChallengeOption(entry.Verifier))
+	}
+
+	state := s.states.Issue(entry)
+	return s.config.AuthCodeURL(state, authOpts...), state
+}
+
+// ParseState verifies the signature of a state value issued by the service's state store and
+// returns the login options it carries, without consuming the state
+func (s *OAuthService) ParseState(state string) (*LoginOptions, error) {
+	return s.states.Decode(state)
+}
+
+// ExchangeCode validates the returned state and exchanges an authorization code for a token
+func (s *OAuthService) ExchangeCode(ctx context.Context, code, state string) (*oauth2.Token, error) {
+	entry, err := s.states.Consume(s.provider, state)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []oauth2.AuthCodeOption
+	if entry.Verifier != "" {
+		opts = append(opts, oauth2.VerifierOption(entry.Verifier))
+	}
+
+	return s.config.Exchange(s.clientContext(ctx), code, opts...)
+}
+
+// CreateSession stores the full token, including its refresh token and expiry,
+// and returns an opaque session ID that refers to it
+func (s *OAuthService) CreateSession(token *oauth2.Token) (string, error) {
+	sessionID := generateSessionID()
+	if err := s.tokens.Put(sessionID, &TokenRecord{
+		Provider: s.provider,
+		Token:    token,
+		Scope:    grantedScope(token),
+	}); err != nil {
+		return "", err
+	}
+	return sessionID, nil
+}
+
+// ExchangeToken validates the returned state, exchanges an authorization code for a token and
+// stores it, returning the session ID that refers to it. The token never leaves the server.
+func (s *OAuthService) ExchangeToken(ctx context.Context, code, state string) (string, error) {
+	token, err := s.ExchangeCode(ctx, code, state)
+	if err != nil {
+		return "", err
+	}
+	return s.CreateSession(token)
+}
+
+// TokenSource returns a token source for the token stored under a session ID.
+// Expired tokens are refreshed and persisted, one request of a session at a time; a refresh the
+// provider rejects returns ErrReauthorizationRequired. Refreshes are bound to ctx.
+func (s *OAuthService) TokenSource(ctx context.Context, sessionID string) (oauth2.TokenSource, error) {
+	record, err := s.session(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return newPersistingTokenSource(s.clientContext(ctx), s.config, s.tokens, sessionID, record), nil
+}
+
+// EndSession deletes the token stored under a session ID
+func (s *OAuthService) EndSession(sessionID string) error {
+	if _, err := s.session(sessionID); err != nil {
+		return err
+	}
+	return s.tokens.Delete(sessionID)
+}
+
+// RevokeFunc revokes a token with the provider
+type RevokeFunc func(ctx context.Context, token *oauth2.Token) error
+
+// RevokeSession revokes a session's token with the provider using revoke and then deletes it.
+// Revoking an unknown or already revoked session is not an error. If the provider
+// call fails the stored token is kept so the revocation can be retried.
+func (s *OAuthService) RevokeSession(ctx context.Context, sessionID string, revoke RevokeFunc) error {
+	record, err := s.session(sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := revoke(ctx, record.Token); err != nil {
+		return err
+	}
+	return s.tokens.Delete(sessionID)
+}
+
+// clientContext returns ctx carrying the service's HTTP client for the oauth2 package
+func (s *OAuthService) clientContext(ctx context.Context) context.Context {
+	if s.client == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, s.client)
+}
+
+// session returns the record stored under a session ID issued by this provider
+func (s *OAuthService) session(sessionID string) (*TokenRecord, error) {
+	if sessionID == "" {
+		return nil, ErrSessionNotFound
+	}
+
+	record, err := s.tokens.Get(sessionID)
+	if errors.Is(err, ErrTokenNotFound) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if record.Provider != s.provider {
+		return nil, ErrSessionNotFound
+	}
+	return record, nil
 }
 
 // generateRandomState generates a random state for OAuth
@@ -37,3 +177,10 @@ func generateRandomState() string {
 	rand.Read(b)
 	return base64.URLEncoding.EncodeToString(b)
 }
+
+// generateSessionID generates a random opaque session ID
+func generateSessionID() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrRecordNotFound is returned by a Backend when no record exists for an ID
+var ErrRecordNotFound = errors.New("record not found")
+
+// Backend persists serialized token records by ID
+type Backend interface {
+	// Load returns the record stored under id or ErrRecordNotFound
+	Load(id string) ([]byte, error)
+
+	// Save stores the record under id, replacing any existing record
+	Save(id string, data []byte) error
+
+	// Delete removes the record stored under id; deleting a missing record is not an error
+	Delete(id string) error
+
+	// IDs lists the IDs of every stored record
+	IDs() ([]string, error)
+}
+
+// MemoryBackend keeps records in memory; they are lost when the process exits
+type MemoryBackend struct {
+	mu      sync.RWMutex
+	records map[string][]byte
+}
+
+// NewMemoryBackend creates a new in-memory backend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		records: make(map[string][]byte),
+	}
+}
+
+// Load returns the record stored under id
+func (b *MemoryBackend) Load(id string) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	data, ok := b.records[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Save stores the record under id
+func (b *MemoryBackend) Save(id string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.records[id] = append([]byte(nil), data...)
+	return nil
+}
+
+// Delete removes the record stored under id
+func (b *MemoryBackend) Delete(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.records, id)
+	return nil
+}
+
+// IDs lists the IDs of every stored record
+func (b *MemoryBackend) IDs() ([]string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	ids := make([]string, 0, len(b.records))
+	for id := range b.records {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// recordFileExt is the extension of record files written by FileBackend
+const recordFileExt = ".json"
+
+// FileBackend keeps one file per record in a directory
+type FileBackend struct {
+	dir string
+}
+
+// NewFileBackend creates a file backend rooted at dir, creating the directory if needed
+func NewFileBackend(dir string) (*FileBackend, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create token directory: %w", err)
+	}
+	return &FileBackend{dir: dir}, nil
+}
+
+// Load returns the record stored under id
+func (b *FileBackend) Load(id string) ([]byte, error) {
+	data, err := os.ReadFile(b.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read record: %w", err)
+	}
+	return data, nil
+}
+
+// Save stores the record under id, writing it atomically
+func (b *FileBackend) Save(id string, data []byte) error {
+	tmp, err := os.CreateTemp(b.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create record: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), b.path(id)); err != nil {
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the record stored under id
+func (b *FileBackend) Delete(id string) error {
+	if err := os.Remove(b.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete record: %w", err)
+	}
+	return nil
+}
+
+// IDs lists the IDs of every stored record
+func (b *FileBackend) IDs() ([]string, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list records: %w", err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, recordFileExt) {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, recordFileExt))
+	}
+	return ids, nil
+}
+
+// path returns the file a record is stored in
+func (b *FileBackend) path(id string) string {
+	return filepath.Join(b.dir, id+recordFileExt)
+}
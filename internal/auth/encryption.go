@@ -0,0 +1,314 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encryptionVersion prefixes every record written by EncryptedBackend
+const encryptionVersion byte = 1
+
+// dataKeySize is the size of the per-record AES-256 data key
+const dataKeySize = 32
+
+// Encryption errors
+var (
+	ErrUnknownKeyID     = errors.New("unknown encryption key ID")
+	ErrNotEncrypted     = errors.New("record is not encrypted")
+	ErrMalformedRecord  = errors.New("malformed encrypted record")
+	ErrNoEncryptionKeys = errors.New("no encryption keys configured")
+)
+
+// Keyring holds the key-encryption keys used for token records.
+// New records are encrypted with the primary key; older keys are kept for decryption.
+type Keyring struct {
+	keys    map[string][]byte
+	primary string
+}
+
+// NewKeyring creates a keyring from 32-byte keys indexed by key ID
+func NewKeyring(keys map[string][]byte, primary string) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoEncryptionKeys
+	}
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("invalid encryption key ID %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %q must be 32 bytes, got %d", id, len(key))
+		}
+	}
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("%w: primary key %q", ErrUnknownKeyID, primary)
+	}
+	return &Keyring{keys: keys, primary: primary}, nil
+}
+
+// ParseKeyring parses keys in the form "id1:base64key,id2:base64key".
+// If primary is empty the first key listed becomes the primary key.
+func ParseKeyring(spec, primary string) (*Keyring, error) {
+	keys := make(map[string][]byte)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("encryption key %q must be in the form id:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q is not valid base64: %w", id, err)
+		}
+		if _, exists := keys[id]; exists {
+			return nil, fmt.Errorf("encryption key %q is listed twice", id)
+		}
+
+		keys[id] = key
+		if primary == "" {
+			primary = id
+		}
+	}
+	return NewKeyring(keys, primary)
+}
+
+// PrimaryKeyID returns the ID of the key used for new records
+func (k *Keyring) PrimaryKeyID() string {
+	return k.primary
+}
+
+// Encrypt seals plaintext with a fresh data key wrapped by the primary key.
+// The record ID is bound as additional data so a record cannot be moved to another ID.
+//
+// Layout: version | key ID length | key ID | wrapped data key | nonce | ciphertext
+func (k *Keyring) Encrypt(id string, plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrappedKey, err := seal(k.keys[k.primary], dataKey, []byte(k.primary))
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := seal(dataKey, plaintext, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(encryptionVersion)
+	buf.WriteByte(byte(len(k.primary)))
+	buf.WriteString(k.primary)
+	buf.Write(wrappedKey)
+	buf.Write(ciphertext)
+	return buf.Bytes(), nil
+}
+
+// Decrypt opens a record sealed by Encrypt with any key in the keyring
+func (k *Keyring) Decrypt(id string, data []byte) ([]byte, error) {
+	keyID, rest, err := splitKeyID(data)
+	if err != nil {
+		return nil, err
+	}
+
+	kek, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, keyID)
+	}
+
+	wrappedKeySize := nonceSize + dataKeySize + tagSize
+	if len(rest) < wrappedKeySize+nonceSize+tagSize {
+		return nil, ErrMalformedRecord
+	}
+
+	dataKey, err := open(kek, rest[:wrappedKeySize], []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	plaintext, err := open(dataKey, rest[wrappedKeySize:], []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt record: %w", err)
+	}
+	return plaintext, nil
+}
+
+// RecordKeyID returns the ID of the key a record was encrypted with
+func RecordKeyID(data []byte) (string, error) {
+	keyID, _, err := splitKeyID(data)
+	return keyID, err
+}
+
+// splitKeyID parses the header of an encrypted record
+func splitKeyID(data []byte) (string, []byte, error) {
+	if len(data) == 0 || data[0] != encryptionVersion {
+		return "", nil, ErrNotEncrypted
+	}
+	if len(data) < 2 || len(data) < 2+int(data[1]) {
+		return "", nil, ErrMalformedRecord
+	}
+	end := 2 + int(data[1])
+	return string(data[2:end]), data[end:], nil
+}
+
+// AES-GCM parameters
+const (
+	nonceSize = 12
+	tagSize   = 16
+)
+
+// seal encrypts plaintext with AES-GCM and prepends the nonce
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts data produced by seal
+func open(key, data, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < nonceSize {
+		return nil, ErrMalformedRecord
+	}
+	return aead.Open(nil, data[:nonceSize], data[nonceSize:], additionalData)
+}
+
+// newGCM creates an AES-GCM cipher for key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptedBackend encrypts records before handing them to another Backend
+type EncryptedBackend struct {
+	backend Backend
+	keyring *Keyring
+}
+
+// NewEncryptedBackend wraps backend so every record is encrypted at rest
+func NewEncryptedBackend(backend Backend, keyring *Keyring) *EncryptedBackend {
+	return &EncryptedBackend{
+		backend: backend,
+		keyring: keyring,
+	}
+}
+
+// Load returns the decrypted record stored under id
+func (b *EncryptedBackend) Load(id string) ([]byte, error) {
+	data, err := b.backend.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	return b.keyring.Decrypt(id, data)
+}
+
+// Save encrypts the record with the primary key and stores it under id
+func (b *EncryptedBackend) Save(id string, data []byte) error {
+	ciphertext, err := b.keyring.Encrypt(id, data)
+	if err != nil {
+		return err
+	}
+	return b.backend.Save(id, ciphertext)
+}
+
+// Delete removes the record stored under id
+func (b *EncryptedBackend) Delete(id string) error {
+	return b.backend.Delete(id)
+}
+
+// IDs lists the IDs of every stored record
+func (b *EncryptedBackend) IDs() ([]string, error) {
+	return b.backend.IDs()
+}
+
+// CountPlaintext returns the number of records in backend that are not encrypted, such as records
+// written before encryption was enabled, which an EncryptedBackend cannot read
+func CountPlaintext(backend Backend) (int, error) {
+	ids, err := backend.IDs()
+	if err != nil {
+		return 0, err
+	}
+
+	plaintext := 0
+	for _, id := range ids {
+		data, err := backend.Load(id)
+		if errors.Is(err, ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return plaintext, fmt.Errorf("record %s: %w", id, err)
+		}
+		if _, err := RecordKeyID(data); errors.Is(err, ErrNotEncrypted) {
+			plaintext++
+		}
+	}
+	return plaintext, nil
+}
+
+// ReEncrypt rewrites every record in backend under the keyring's primary key.
+// Records already using the primary key are left untouched and plaintext records
+// written before encryption was enabled are encrypted. It returns the number of records rewritten.
+func ReEncrypt(backend Backend, keyring *Keyring) (int, error) {
+	ids, err := backend.IDs()
+	if err != nil {
+		return 0, err
+	}
+
+	rewritten := 0
+	for _, id := range ids {
+		data, err := backend.Load(id)
+		if errors.Is(err, ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return rewritten, fmt.Errorf("record %s: %w", id, err)
+		}
+
+		keyID, err := RecordKeyID(data)
+		switch {
+		case errors.Is(err, ErrNotEncrypted):
+			// Plaintext record from before encryption was enabled
+		case err != nil:
+			return rewritten, fmt.Errorf("record %s: %w", id, err)
+		case keyID == keyring.PrimaryKeyID():
+			continue
+		default:
+			if data, err = keyring.Decrypt(id, data); err != nil {
+				return rewritten, fmt.Errorf("record %s: %w", id, err)
+			}
+		}
+
+		ciphertext, err := keyring.Encrypt(id, data)
+		if err != nil {
+			return rewritten, fmt.Errorf("record %s: %w", id, err)
+		}
+		if err := backend.Save(id, ciphertext); err != nil {
+			return rewritten, fmt.Errorf("record %s: %w", id, err)
+		}
+		rewritten++
+	}
+
+	return rewritten, nil
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+// newTestKeyring creates a keyring with random keys under the given IDs; the first becomes the primary key
+func newTestKeyring(t *testing.T, ids ...string) *Keyring {
+	t.Helper()
+	keys := make(map[string][]byte, len(ids))
+	for _, id := range ids {
+		keys[id] = randomKey(t)
+	}
+	keyring, err := NewKeyring(keys, ids[0])
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return keyring
+}
+
+// rotated returns a keyring with a new primary key that still lists every key of old
+func rotated(t *testing.T, old *Keyring, primary string) *Keyring {
+	t.Helper()
+	keys := map[string][]byte{primary: randomKey(t)}
+	for id, key := range old.keys {
+		keys[id] = key
+	}
+	keyring, err := NewKeyring(keys, primary)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return keyring
+}
+
+func randomKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("rand.Read: %v", err)
+	}
+	return key
+}
+
+func TestDecryptRecordUnderOlderKey(t *testing.T) {
+	oldKeyring := newTestKeyring(t, "2023-06")
+	plaintext := []byte(`{"token":"secret"}`)
+
+	ciphertext, err := oldKeyring.Encrypt("session-1", plaintext)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	keyring := rotated(t, oldKeyring, "2024-01")
+	got, err := keyring.Decrypt("session-1", ciphertext)
+	if err != nil {
+		t.Fatalf("Decrypt with rotated keyring: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("Decrypt = %q, want %q", got, plaintext)
+	}
+
+	// New records go under the new primary key
+	ciphertext, err = keyring.Encrypt("session-2", plaintext)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if keyID, _ := RecordKeyID(ciphertext); keyID != "2024-01" {
+		t.Errorf("RecordKeyID = %q, want %q", keyID, "2024-01")
+	}
+}
+
+func TestReEncrypt(t *testing.T) {
+	oldKeyring := newTestKeyring(t, "2023-06")
+	keyring := rotated(t, oldKeyring, "2024-01")
+	backend := NewMemoryBackend()
+
+	records := map[string][]byte{
+		"old":       []byte(`{"token":"old"}`),
+		"current":   []byte(`{"token":"current"}`),
+		"plaintext": []byte(`{"token":"plaintext"}`),
+	}
+	save := func(id string, keyring *Keyring) {
+		data := records[id]
+		if keyring != nil {
+			var err error
+			if data, err = keyring.Encrypt(id, data); err != nil {
+				t.Fatalf("Encrypt %s: %v", id, err)
+			}
+		}
+		if err := backend.Save(id, data); err != nil {
+			t.Fatalf("Save %s: %v", id, err)
+		}
+	}
+	save("old", oldKeyring)
+	save("current", keyring)
+	save("plaintext", nil)
+
+	current, _ := backend.Load("current")
+	if n, err := CountPlaintext(backend); err != nil || n != 1 {
+		t.Fatalf("CountPlaintext = %d, %v, want 1", n, err)
+	}
+
+	rewritten, err := ReEncrypt(backend, keyring)
+	if err != nil {
+		t.Fatalf("ReEncrypt: %v", err)
+	}
+	if rewritten != 2 {
+		t.Errorf("ReEncrypt rewrote %d records, want 2", rewritten)
+	}
+
+	// The record already under the primary key is left as it was
+	if data, _ := backend.Load("current"); !bytes.Equal(data, current) {
+		t.Error("ReEncrypt rewrote a record already under the primary key")
+	}
+
+	for id, want := range records {
+		data, err := backend.Load(id)
+		if err != nil {
+			t.Fatalf("Load %s: %v", id, err)
+		}
+		if keyID, err := RecordKeyID(data); err != nil || keyID != "2024-01" {
+			t.Errorf("record %s is under key %q (%v), want %q", id, keyID, err, "2024-01")
+		}
+		got, err := keyring.Decrypt(id, data)
+		if err != nil {
+			t.Fatalf("Decrypt %s: %v", id, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("record %s = %q, want %q", id, got, want)
+		}
+	}
+
+	if n, err := CountPlaintext(backend); err != nil || n != 0 {
+		t.Errorf("CountPlaintext after ReEncrypt = %d, %v, want 0", n, err)
+	}
+}
+
+func TestDecryptRejectsTamperedAndMovedRecords(t *testing.T) {
+	keyring := newTestKeyring(t, "2024-01")
+	ciphertext, err := keyring.Encrypt("session-1", []byte(`{"token":"secret"}`))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	tampered := bytes.Clone(ciphertext)
+	tampered[len(tampered)-1] ^= 0x01
+	if _, err := keyring.Decrypt("session-1", tampered); err == nil {
+		t.Error("Decrypt accepted a tampered record")
+	}
+
+	if _, err := keyring.Decrypt("session-2", ciphertext); err == nil {
+		t.Error("Decrypt accepted a record moved to another ID")
+	}
+}
@@ -26,6 +26,6 @@ func (s *Service) GetAuthURL() string {
 }
 
 // ExchangeCode exchanges an authorization code for an OAuth2 token
-func (s *Service) ExchangeCode(code string) (*oauth2.Token, error) {
-	return s.config.Exchange(context.Background(), code)
+func (s *Service) ExchangeCode(ctx context.Context, code string) (*oauth2.Token, error) {
+	return s.config.Exchange(ctx, code)
 }
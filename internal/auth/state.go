@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StateTTL is how long an issued OAuth state stays valid
+const StateTTL = 10 * time.Minute
+
+// OAuth state validation errors
+var (
+	ErrStateMissing  = errors.New("state parameter is missing")
+	ErrStateMismatch = errors.New("state does not belong to this browser")
+	ErrStateUnknown  = errors.New("state is unknown")
+	ErrStateExpired  = errors.New("state has expired")
+	ErrStateReplayed = errors.New("state has already been used")
+)
+
+// IsStateError reports whether err is an OAuth state validation error
+func IsStateError(err error) bool {
+	return errors.Is(err, ErrStateMissing) ||
+		errors.Is(err, ErrStateMismatch) ||
+		errors.Is(err, ErrStateUnknown) ||
+		errors.Is(err, ErrStateExpired) ||
+		errors.Is(err, ErrStateReplayed)
+}
+
+// LoginOptions describe where the result of a login is delivered
+type LoginOptions struct {
+	ReturnTo     string `json:"r,omitempty"`
+	ResponseMode string `json:"m,omitempty"`
+}
+
+// State is the data recorded for a single login attempt
+type State struct {
+	LoginOptions
+	Provider  string
+	Verifier  string // PKCE code verifier, empty when PKCE is not used
+	ExpiresAt time.Time
+	used      bool
+}
+
+// statePayload is the signed part of a state value
+type statePayload struct {
+	Nonce string `json:"n"`
+	LoginOptions
+}
+
+// StateStore keeps issued OAuth states until they are consumed or expire.
+// State values carry the login options and an HMAC signature, so a callback can
+// tell where to deliver its result before the state is looked up.
+type StateStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	secret  []byte
+	entries map[string]*State
+}
+
+// NewStateStore creates a new state store with the given TTL and signing secret.
+// A random secret is generated when secret is empty.
+func NewStateStore(ttl time.Duration, secret []byte) *StateStore {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return &StateStore{
+		ttl:     ttl,
+		secret:  secret,
+		entries: make(map[string]*State),
+	}
+}
+
+// defaultStates is shared by every OAuth service in the process
+var defaultStates = NewStateStore(StateTTL, nil)
+
+// SetDefaultStateStore replaces the state store used by OAuth services created afterwards
+func SetDefaultStateStore(store *StateStore) {
+	defaultStates = store
+}
+
+// Issue records a login attempt and returns the signed state value identifying it
+func (s *StateStore) Issue(entry State) string {
+	state := s.sign(statePayload{
+		Nonce:        generateRandomState(),
+		LoginOptions: entry.LoginOptions,
+	})
+	now := time.Now()
+	entry.ExpiresAt = now.Add(s.ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(now)
+	s.entries[state] = &entry
+	return state
+}
+
+// Consume validates a state returned to the callback, marks it as used and returns its login attempt
+func (s *StateStore) Consume(provider, state string) (*State, error) {
+	if _, err := s.Decode(state); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[state]
+	if !ok || entry.Provider != provider {
+		return nil, ErrStateUnknown
+	}
+	if time.Now().After(entry.ExpiresAt) {
+		delete(s.entries, state)
+		return nil, ErrStateExpired
+	}
+	if entry.used {
+		return nil, ErrStateReplayed
+	}
+
+	// Used states are kept until they expire so replays can be told apart from unknown states
+	entry.used = true
+	consumed := *entry
+	return &consumed, nil
+}
+
+// prune removes expired states; the caller must hold the lock
+func (s *StateStore) prune(now time.Time) {
+	for state, entry := range s.entries {
+		if now.After(entry.ExpiresAt) {
+			delete(s.entries, state)
+		}
+	}
+}
+
+// Decode verifies the signature of a state value and returns the login options it carries.
+// It does not check whether the state was issued, used or has expired.
+func (s *StateStore) Decode(state string) (*LoginOptions, error) {
+	if state == "" {
+		return nil, ErrStateMissing
+	}
+
+	encoded, signature, ok := strings.Cut(state, ".")
+	if !ok {
+		return nil, ErrStateUnknown
+	}
+	expected := s.signature(encoded)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return nil, ErrStateUnknown
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrStateUnknown
+	}
+	var payload statePayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, ErrStateUnknown
+	}
+	return &payload.LoginOptions, nil
+}
+
+// sign encodes a payload and appends its signature
+func (s *StateStore) sign(payload statePayload) string {
+	data, _ := json.Marshal(payload)
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + s.signature(encoded)
+}
+
+// signature returns the HMAC-SHA256 of an encoded payload
+func (s *StateStore) signature(encoded string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
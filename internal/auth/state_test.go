@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestStateConsume(t *testing.T) {
+	store := NewStateStore(StateTTL, []byte("secret"))
+	opts := LoginOptions{ReturnTo: "https://app.example.com/done", ResponseMode: "fragment"}
+	state := store.Issue(State{LoginOptions: opts, Provider: "twitter", Verifier: "verifier"})
+
+	entry, err := store.Consume("twitter", state)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	if entry.LoginOptions != opts || entry.Verifier != "verifier" {
+		t.Errorf("Consume = %+v, want the issued login attempt", entry)
+	}
+
+	if _, err := store.Consume("twitter", state); !errors.Is(err, ErrStateReplayed) {
+		t.Errorf("second Consume = %v, want ErrStateReplayed", err)
+	}
+}
+
+func TestStateExpires(t *testing.T) {
+	store := NewStateStore(-time.Second, []byte("secret"))
+	state := store.Issue(State{Provider: "twitter"})
+
+	if _, err := store.Consume("twitter", state); !errors.Is(err, ErrStateExpired) {
+		t.Errorf("Consume of an expired state = %v, want ErrStateExpired", err)
+	}
+	if _, err := store.Consume("twitter", state); !errors.Is(err, ErrStateUnknown) {
+		t.Errorf("Consume after the expired state was dropped = %v, want ErrStateUnknown", err)
+	}
+}
+
+func TestStateRejectsWrongProvider(t *testing.T) {
+	store := NewStateStore(StateTTL, []byte("secret"))
+	state := store.Issue(State{Provider: "twitter"})
+
+	if _, err := store.Consume("discord", state); !errors.Is(err, ErrStateUnknown) {
+		t.Errorf("Consume by another provider = %v, want ErrStateUnknown", err)
+	}
+
+	// The rejected attempt does not use the state up
+	if _, err := store.Consume("twitter", state); err != nil {
+		t.Errorf("Consume by the issuing provider: %v", err)
+	}
+}
+
+func TestStateRejectsForgedSignature(t *testing.T) {
+	store := NewStateStore(StateTTL, []byte("secret"))
+	state := store.Issue(State{Provider: "twitter", LoginOptions: LoginOptions{ReturnTo: "https://app.example.com"}})
+	encoded, signature, _ := strings.Cut(state, ".")
+
+	// A payload pointing somewhere else, signed with another secret or not at all
+	forged := NewStateStore(StateTTL, []byte("other secret")).sign(statePayload{
+		Nonce:        "nonce",
+		LoginOptions: LoginOptions{ReturnTo: "https://evil.example.com"},
+	})
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	tests := map[string]string{
+		"other secret":        forged,
+		"swapped payload":     forgedPayload + "." + signature,
+		"truncated signature": encoded + "." + signature[:len(signature)-2],
+		"no signature":        encoded,
+		"not base64":          "!!!." + signature,
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := store.Decode(value); !errors.Is(err, ErrStateUnknown) {
+				t.Errorf("Decode = %v, want ErrStateUnknown", err)
+			}
+			if _, err := store.Consume("twitter", value); !errors.Is(err, ErrStateUnknown) {
+				t.Errorf("Consume = %v, want ErrStateUnknown", err)
+			}
+		})
+	}
+
+	if _, err := store.Decode(""); !errors.Is(err, ErrStateMissing) {
+		t.Errorf("Decode of an empty state = %v, want ErrStateMissing", err)
+	}
+}
+
+func TestParseStateUsesServiceStore(t *testing.T) {
+	service := NewOAuthService("twitter", &oauth2.Config{})
+	service.states = NewStateStore(StateTTL, []byte("secret"))
+
+	opts := LoginOptions{ReturnTo: "https://app.example.com/done", ResponseMode: "popup"}
+	_, state := service.GetAuthURL(opts)
+
+	got, err := service.ParseState(state)
+	if err != nil {
+		t.Fatalf("ParseState: %v", err)
+	}
+	if *got != opts {
+		t.Errorf("ParseState = %+v, want %+v", *got, opts)
+	}
+
+	other := NewStateStore(StateTTL, []byte("other secret")).Issue(State{Provider: "twitter"})
+	if _, err := service.ParseState(other); !errors.Is(err, ErrStateUnknown) {
+		t.Errorf("ParseState of a state from another store = %v, want ErrStateUnknown", err)
+	}
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// persistingTokenSource refreshes a stored token when it expires and writes the refreshed token back
+type persistingTokenSource struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	config *oauth2.Config
+	key    string
+	record *TokenRecord
+	store  *TokenStore
+}
+
+// Token returns a valid token, refreshing and persisting it if the stored one has expired
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.record.Token.Valid() {
+		if err := s.refresh(); err != nil {
+			return nil, err
+		}
+	}
+
+	// The stored token loses its extra fields, so hand the granted scopes back explicitly
+	return s.record.Token.WithExtra(map[string]interface{}{"scope": s.record.Scope}), nil
+}
+
+// refresh replaces the expired token of the record. Handlers create a token source per request, so
+// refreshes are serialized per session in the store: providers that rotate refresh tokens reject
+// the second of two concurrent refreshes with invalid_grant.
+func (s *persistingTokenSource) refresh() error {
+	unlock := s.store.lock(s.key)
+	defer unlock()
+
+	// Another request may have refreshed the token while this one waited for the lock
+	record, err := s.store.Get(s.key)
+	if errors.Is(err, ErrTokenNotFound) {
+		return fmt.Errorf("%w: the session has ended", ErrReauthorizationRequired)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load token: %w", err)
+	}
+	if record.Token.Valid() {
+		s.record = record
+		return nil
+	}
+
+	token, err := s.config.TokenSource(s.ctx, record.Token).Token()
+	if err != nil {
+		if record.Token.RefreshToken == "" || refreshRejected(err) {
+			return fmt.Errorf("%w: %v", ErrReauthorizationRequired, err)
+		}
+		// Network errors, timeouts and token endpoint outages are temporary, so the user keeps the session
+		return fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	record.Token = token
+	if scope := grantedScope(token); scope != "" {
+		record.Scope = scope
+	}
+	if err := s.store.Put(s.key, record); err != nil {
+		return fmt.Errorf("failed to persist refreshed token: %w", err)
+	}
+	s.record = record
+	return nil
+}
+
+// newPersistingTokenSource creates a token source for a stored record
+func newPersistingTokenSource(ctx context.Context, config *oauth2.Config, store *TokenStore, key string, record *TokenRecord) oauth2.TokenSource {
+	return &persistingTokenSource{
+		ctx:    ctx,
+		config: config,
+		key:    key,
+		record: record,
+		store:  store,
+	}
+}
+
+// refreshRejected reports whether the token endpoint refused the refresh token, for example with
+// invalid_grant after the user revoked the app, so only a new login can help
+func refreshRejected(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) || retrieveErr.Response == nil {
+		return false
+	}
+	if retrieveErr.ErrorCode == "invalid_grant" {
+		return true
+	}
+	status := retrieveErr.Response.StatusCode
+	return status >= http.StatusBadRequest && status < http.StatusInternalServerError && status != http.StatusTooManyRequests
+}
+
+// grantedScope returns the scope parameter of a token response, if the provider sent one
+func grantedScope(token *oauth2.Token) string {
+	scope, _ := token.Extra("scope").(string)
+	return scope
+}
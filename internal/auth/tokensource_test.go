@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestRefreshRejected(t *testing.T) {
+	retrieveError := func(status int, code string) error {
+		return fmt.Errorf("oauth2: %w", &oauth2.RetrieveError{Response: &http.Response{StatusCode: status}, ErrorCode: code})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"invalid_grant", retrieveError(http.StatusBadRequest, "invalid_grant"), true},
+		{"invalid_grant with 200", retrieveError(http.StatusOK, "invalid_grant"), true},
+		{"invalid_client", retrieveError(http.StatusUnauthorized, "invalid_client"), true},
+		{"bad request", retrieveError(http.StatusBadRequest, ""), true},
+		{"rate limited", retrieveError(http.StatusTooManyRequests, ""), false},
+		{"server error", retrieveError(http.StatusInternalServerError, ""), false},
+		{"unavailable", retrieveError(http.StatusServiceUnavailable, "temporarily_unavailable"), false},
+		{"no response", &oauth2.RetrieveError{ErrorCode: "invalid_grant"}, false},
+		{"network error", errors.New("dial tcp: connection refused"), false},
+		{"timeout", context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refreshRejected(tt.err); got != tt.want {
+				t.Errorf("refreshRejected(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// rotatingTokenServer is a token endpoint that rotates refresh tokens: each one is accepted once and
+// then rejected with invalid_grant
+type rotatingTokenServer struct {
+	mu        sync.Mutex
+	refreshed int
+	current   string
+}
+
+func (s *rotatingTokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.FormValue("refresh_token") != s.current {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"invalid_grant"}`)
+		return
+	}
+
+	// Slow enough that concurrent refreshes would overlap
+	time.Sleep(20 * time.Millisecond)
+	s.refreshed++
+	s.current = fmt.Sprintf("refresh-%d", s.refreshed)
+	fmt.Fprintf(w, `{"access_token":"access-%d","token_type":"Bearer","refresh_token":%q,"expires_in":3600}`, s.refreshed, s.current)
+}
+
+func TestConcurrentRefreshOfOneSession(t *testing.T) {
+	tokenServer := &rotatingTokenServer{current: "refresh-0"}
+	server := httptest.NewServer(tokenServer)
+	defer server.Close()
+
+	config := &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{TokenURL: server.URL, AuthStyle: oauth2.AuthStyleInParams},
+	}
+	store := NewTokenStore(NewMemoryBackend())
+	expired := &oauth2.Token{AccessToken: "access-0", RefreshToken: "refresh-0", Expiry: time.Now().Add(-time.Minute)}
+	if err := store.Put("session", &TokenRecord{Provider: "twitter", Token: expired}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// Like the handlers, every request loads the record and builds a token source of its own
+	const requests = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for range requests {
+		record, err := store.Get("session")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		source := newPersistingTokenSource(context.Background(), config, store, "session", record)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := source.Token()
+			if err == nil && token.AccessToken != "access-1" {
+				err = fmt.Errorf("got access token %q, want access-1", token.AccessToken)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Token: %v", err)
+		}
+	}
+	if tokenServer.refreshed != 1 {
+		t.Errorf("token endpoint refreshed %d times, want 1", tokenServer.refreshed)
+	}
+
+	record, err := store.Get("session")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if record.Token.RefreshToken != "refresh-1" {
+		t.Errorf("stored refresh token = %q, want refresh-1", record.Token.RefreshToken)
+	}
+	if len(store.locks) != 0 {
+		t.Errorf("store holds %d session locks after the refreshes, want 0", len(store.locks))
+	}
+}
+
+func TestRefreshRejectedRequiresReauthorization(t *testing.T) {
+	tokenServer := &rotatingTokenServer{current: "refresh-1"}
+	server := httptest.NewServer(tokenServer)
+	defer server.Close()
+
+	config := &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{TokenURL: server.URL, AuthStyle: oauth2.AuthStyleInParams},
+	}
+	store := NewTokenStore(NewMemoryBackend())
+	record := &TokenRecord{Token: &oauth2.Token{AccessToken: "access-0", RefreshToken: "refresh-0", Expiry: time.Now().Add(-time.Minute)}}
+	if err := store.Put("session", record); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	_, err := newPersistingTokenSource(context.Background(), config, store, "session", record).Token()
+	if !errors.Is(err, ErrReauthorizationRequired) {
+		t.Errorf("Token with a spent refresh token = %v, want ErrReauthorizationRequired", err)
+	}
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Token store errors
+var (
+	ErrTokenNotFound           = errors.New("token not found")
+	ErrSessionNotFound         = errors.New("session not found")
+	ErrReauthorizationRequired = errors.New("reauthorization required")
+)
+
+// TokenRecord is a platform token kept server-side
+type TokenRecord struct {
+	Provider  string        `json:"provider"`
+	Token     *oauth2.Token `json:"token"`
+	Scope     string        `json:"scope,omitempty"` // space-separated scopes granted by the provider
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
+
+// TokenStore persists token records in a Backend.
+// Keys are hashed before they reach the backend so they never appear in storage.
+type TokenStore struct {
+	backend Backend
+
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+// keyLock serializes the refreshes of one key's token; refs counts the holders and waiters
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewTokenStore creates a token store on top of the given backend
+func NewTokenStore(backend Backend) *TokenStore {
+	return &TokenStore{backend: backend, locks: make(map[string]*keyLock)}
+}
+
+// defaultTokens is shared by every OAuth service in the process
+var defaultTokens = NewTokenStore(NewMemoryBackend())
+
+// SetDefaultTokenStore replaces the token store used by OAuth services created afterwards
+func SetDefaultTokenStore(store *TokenStore) {
+	defaultTokens = store
+}
+
+// Get returns the record stored under key or ErrTokenNotFound
+func (s *TokenStore) Get(key string) (*TokenRecord, error) {
+	data, err := s.backend.Load(recordID(key))
+	if errors.Is(err, ErrRecordNotFound) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record TokenRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode token record: %w", err)
+	}
+	return &record, nil
+}
+
+// Put stores a record under key
+func (s *TokenStore) Put(key string, record *TokenRecord) error {
+	record.UpdatedAt = time.Now()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode token record: %w", err)
+	}
+	return s.backend.Save(recordID(key), data)
+}
+
+// Delete removes the record stored under key
+func (s *TokenStore) Delete(key string) error {
+	return s.backend.Delete(recordID(key))
+}
+
+// lock takes the lock of a key, so that only one request at a time refreshes the key's token, and
+// returns the function that releases it
+func (s *TokenStore) lock(key string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[key]
+	if !ok {
+		l = &keyLock{}
+		s.locks[key] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(s.locks, key)
+		}
+	}
+}
+
+// recordID derives the backend ID for a key
+func recordID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
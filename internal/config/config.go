@@ -2,39 +2,113 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Config holds all application configuration
 type Config struct {
 	Port string
 
+	// OAuth login
+	OAuthStateSecret  string   // signs OAuth state values, random per process when unset
+	ReturnToAllowlist []string // URL prefixes a login may redirect back to
+
+	// Token storage
+	TokenStorePath       string
+	TokenEncryptionKeys  string // comma-separated id:base64key pairs
+	TokenEncryptionKeyID string // ID of the key used for new records, defaults to the first key
+
+	// Platform checks
+	CheckTimeout       time.Duration // default deadline for a single platform check
+	PaginationMaxPages int           // pages of a following or subscription list a check reads at most
+	PaginationBudget   time.Duration // time a check spends paging through a list at most
+
+	// Upstream rate limits
+	RateLimitMode              string        // "wait" for an exhausted budget to reset or "fail" fast
+	RateLimitMaxWait           time.Duration // longest a request waits for a budget in wait mode
+	RateLimitAppUsageThreshold int           // percentage of the Graph app quota at which requests are held back
+
+	// Upstream retries and circuit breakers
+	RetryMaxAttempts        int           // attempts per idempotent request, including the first
+	RetryBaseDelay          time.Duration // backoff before the first retry
+	RetryMaxDelay           time.Duration // upper bound of a single backoff
+	BreakerFailureThreshold int           // consecutive failures that open a platform's breaker
+	BreakerCooldown         time.Duration // how long an open breaker fails requests fast
+
+	// Upstream HTTP client
+	UpstreamDialTimeout           time.Duration
+	UpstreamTLSHandshakeTimeout   time.Duration
+	UpstreamResponseHeaderTimeout time.Duration
+	UpstreamIdleConnTimeout       time.Duration
+	UpstreamTimeout               time.Duration // overall limit for a single upstream request
+	UpstreamMaxConnsPerHost       int
+	UpstreamMaxIdleConnsPerHost   int
+	UpstreamProxyURL              string // proxy for upstream requests, HTTPS_PROXY and friends when unset
+	UpstreamCAFile                string // PEM bundle trusted in addition to the system roots
+
+	// Admin
+	AdminToken string // bearer token for the admin endpoints, which are disabled when unset
+
+	// Sandbox
+	SandboxMode     bool   // serve simulated platform APIs in-process and use them instead of the real ones
+	SandboxBaseURL  string // where the simulated APIs are reachable
+	SandboxScenario string // JSON scenario file, the built-in scenario when unset
+
 	// YouTube
 	YouTubeClientID     string
 	YouTubeClientSecret string
 	YouTubeRedirectURL  string
 	YouTubeChannelID    string
+	YouTubeAPIKey       string // enables checks of public subscriptions without a Google login
+	YouTubePKCE         bool
+	YouTubeCheckTimeout time.Duration
+	GoogleAuthBaseURL   string // serves the consent screen
+	GoogleOAuthBaseURL  string // serves the token, revocation and tokeninfo endpoints
+	YouTubeAPIBaseURL   string
 
 	// Facebook/Instagram (Meta)
-	MetaAppID       string
-	MetaAppSecret   string
-	MetaRedirectURI string
+	MetaAppID             string
+	MetaAppSecret         string
+	MetaRedirectURI       string
+	InstagramRedirectURI  string
+	FacebookCheckTimeout  time.Duration
+	InstagramCheckTimeout time.Duration
+	MetaAuthBaseURL       string // serves the login dialog, including the API version
+	MetaGraphBaseURL      string // Graph API, including the API version
 
 	// Discord
-	DiscordClientID     string
-	DiscordClientSecret string
-	DiscordRedirectURI  string
-	DiscordServerID     string
+	DiscordClientID           string
+	DiscordClientSecret       string
+	DiscordRedirectURI        string
+	DiscordServerID           string
+	DiscordPKCE               bool
+	DiscordCheckTimeout       time.Duration
+	DiscordAPIBaseURL         string
+	DiscordRequiredRoles      []string      // role IDs a member needs, any or all of them depending on DiscordRoleMatch
+	DiscordRoleMatch          string        // "any" or "all"
+	DiscordMinMemberAge       time.Duration // how long a user must have been a member
+	DiscordRequireBoost       bool          // members must boost the server
+	DiscordBotToken           string        // enables membership checks of known user IDs without their login
+	DiscordMemberSyncInterval time.Duration // how often the bot copies the member list into a local index, never when zero
 
 	// Twitter
 	TwitterClientID     string
 	TwitterClientSecret string
 	TwitterRedirectURI  string
+	TwitterCheckTimeout time.Duration
+	TwitterAuthBaseURL  string // serves the consent screen
+	TwitterAPIBaseURL   string
 
 	// Tiktok
 	TiktokClientID     string
 	TiktokClientSecret string
 	TiktokRedirectURI  string
+	TiktokCheckTimeout time.Duration
+	TiktokAuthBaseURL  string // serves the consent screen
+	TiktokAPIBaseURL   string // serves the token and revocation endpoints and the Display API
 }
 
 var (
@@ -45,41 +119,167 @@ var (
 // LoadConfig loads configuration from environment variables
 func LoadConfig() *Config {
 	once.Do(func() {
+		checkTimeout := getEnvDuration("CHECK_TIMEOUT", 8*time.Second)
+		port := getEnvOrDefault("PORT", "8080")
+		sandbox := getEnvBool("SANDBOX_MODE", false)
+		sandboxURL := getEnvOrDefault("SANDBOX_BASE_URL", "http://localhost:"+port+"/sandbox")
+
+		// upstreamURL returns an upstream's base URL: the configured one, else the simulator in sandbox mode, else the real API
+		upstreamURL := func(key, real, simulated string) string {
+			if sandbox {
+				real = sandboxURL + simulated
+			}
+			return getEnvOrDefault(key, real)
+		}
+
 		config = Config{
-			Port: getEnvOrDefault("PORT", "8080"),
+			Port: port,
+
+			// OAuth login
+			OAuthStateSecret:  os.Getenv("OAUTH_STATE_SECRET"),
+			ReturnToAllowlist: getEnvList("RETURN_TO_ALLOWLIST"),
+
+			// Token storage
+			TokenStorePath:       os.Getenv("TOKEN_STORE_PATH"),
+			TokenEncryptionKeys:  os.Getenv("TOKEN_ENCRYPTION_KEYS"),
+			TokenEncryptionKeyID: os.Getenv("TOKEN_ENCRYPTION_KEY_ID"),
+
+			// Platform checks
+			CheckTimeout:       checkTimeout,
+			PaginationMaxPages: getEnvInt("PAGINATION_MAX_PAGES", 20),
+			PaginationBudget:   getEnvDuration("PAGINATION_BUDGET", 5*time.Second),
+
+			// Upstream rate limits
+			RateLimitMode:              getEnvOrDefault("RATE_LIMIT_MODE", "wait"),
+			RateLimitMaxWait:           getEnvDuration("RATE_LIMIT_MAX_WAIT", 2*time.Second),
+			RateLimitAppUsageThreshold: getEnvInt("RATE_LIMIT_APP_USAGE_THRESHOLD", 90),
+
+			// Upstream retries and circuit breakers
+			RetryMaxAttempts:        getEnvInt("RETRY_MAX_ATTEMPTS", 3),
+			RetryBaseDelay:          getEnvDuration("RETRY_BASE_DELAY", 200*time.Millisecond),
+			RetryMaxDelay:           getEnvDuration("RETRY_MAX_DELAY", 2*time.Second),
+			BreakerFailureThreshold: getEnvInt("BREAKER_FAILURE_THRESHOLD", 5),
+			BreakerCooldown:         getEnvDuration("BREAKER_COOLDOWN", 30*time.Second),
+
+			// Upstream HTTP client
+			UpstreamDialTimeout:           getEnvDuration("UPSTREAM_DIAL_TIMEOUT", 5*time.Second),
+			UpstreamTLSHandshakeTimeout:   getEnvDuration("UPSTREAM_TLS_HANDSHAKE_TIMEOUT", 5*time.Second),
+			UpstreamResponseHeaderTimeout: getEnvDuration("UPSTREAM_RESPONSE_HEADER_TIMEOUT", 10*time.Second),
+			UpstreamIdleConnTimeout:       getEnvDuration("UPSTREAM_IDLE_CONN_TIMEOUT", 90*time.Second),
+			UpstreamTimeout:               getEnvDuration("UPSTREAM_TIMEOUT", 30*time.Second),
+			UpstreamMaxConnsPerHost:       getEnvInt("UPSTREAM_MAX_CONNS_PER_HOST", 32),
+			UpstreamMaxIdleConnsPerHost:   getEnvInt("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", 16),
+			UpstreamProxyURL:              os.Getenv("UPSTREAM_PROXY_URL"),
+			UpstreamCAFile:                os.Getenv("UPSTREAM_CA_FILE"),
+
+			// Admin
+			AdminToken: os.Getenv("ADMIN_TOKEN"),
+
+			// Sandbox
+			SandboxMode:     sandbox,
+			SandboxBaseURL:  sandboxURL,
+			SandboxScenario: os.Getenv("SANDBOX_SCENARIO"),
 
 			// YouTube
 			YouTubeClientID:     os.Getenv("YT_CLIENT_ID"),
 			YouTubeClientSecret: os.Getenv("YT_CLIENT_SECRET"),
 			YouTubeRedirectURL:  os.Getenv("YT_REDIRECT_URL"),
 			YouTubeChannelID:    os.Getenv("YT_CHANNEL_ID"),
+			YouTubeAPIKey:       os.Getenv("YT_API_KEY"),
+			YouTubePKCE:         getEnvBool("YT_PKCE", false),
+			YouTubeCheckTimeout: getEnvDuration("YT_CHECK_TIMEOUT", checkTimeout),
+			GoogleAuthBaseURL:   upstreamURL("GOOGLE_AUTH_BASE_URL", "https://accounts.google.com", "/google"),
+			GoogleOAuthBaseURL:  upstreamURL("GOOGLE_OAUTH_BASE_URL", "https://oauth2.googleapis.com", "/google"),
+			YouTubeAPIBaseURL:   upstreamURL("YT_API_BASE_URL", "https://youtube.googleapis.com", "/google"),
 
 			// Facebook/Instagram (Meta)
-			MetaAppID:       os.Getenv("META_APP_ID"),
-			MetaAppSecret:   os.Getenv("META_APP_SECRET"),
-			MetaRedirectURI: os.Getenv("META_REDIRECT_URI"),
+			MetaAppID:             os.Getenv("META_APP_ID"),
+			MetaAppSecret:         os.Getenv("META_APP_SECRET"),
+			MetaRedirectURI:       os.Getenv("META_REDIRECT_URI"),
+			InstagramRedirectURI:  os.Getenv("INSTAGRAM_REDIRECT_URI"),
+			FacebookCheckTimeout:  getEnvDuration("FACEBOOK_CHECK_TIMEOUT", checkTimeout),
+			InstagramCheckTimeout: getEnvDuration("INSTAGRAM_CHECK_TIMEOUT", checkTimeout),
+			MetaAuthBaseURL:       upstreamURL("META_AUTH_BASE_URL", "https://www.facebook.com/v18.0", "/meta"),
+			MetaGraphBaseURL:      upstreamURL("META_GRAPH_BASE_URL", "https://graph.facebook.com/v18.0", "/meta"),
 
 			// Discord
-			DiscordClientID:     os.Getenv("DISCORD_CLIENT_ID"),
-			DiscordClientSecret: os.Getenv("DISCORD_CLIENT_SECRET"),
-			DiscordRedirectURI:  os.Getenv("DISCORD_REDIRECT_URI"),
-			DiscordServerID:     os.Getenv("DISCORD_SERVER_ID"),
+			DiscordClientID:           os.Getenv("DISCORD_CLIENT_ID"),
+			DiscordClientSecret:       os.Getenv("DISCORD_CLIENT_SECRET"),
+			DiscordRedirectURI:        os.Getenv("DISCORD_REDIRECT_URI"),
+			DiscordServerID:           os.Getenv("DISCORD_SERVER_ID"),
+			DiscordPKCE:               getEnvBool("DISCORD_PKCE", false),
+			DiscordCheckTimeout:       getEnvDuration("DISCORD_CHECK_TIMEOUT", checkTimeout),
+			DiscordAPIBaseURL:         upstreamURL("DISCORD_API_BASE_URL", "https://discord.com/api", "/discord"),
+			DiscordRequiredRoles:      getEnvList("DISCORD_REQUIRED_ROLES"),
+			DiscordRoleMatch:          getEnvOrDefault("DISCORD_ROLE_MATCH", "any"),
+			DiscordMinMemberAge:       getEnvDuration("DISCORD_MIN_MEMBER_AGE", 0),
+			DiscordRequireBoost:       getEnvBool("DISCORD_REQUIRE_BOOST", false),
+			DiscordBotToken:           os.Getenv("DISCORD_BOT_TOKEN"),
+			DiscordMemberSyncInterval: getEnvDuration("DISCORD_MEMBER_SYNC_INTERVAL", 0),
 
 			// Twitter
 			TwitterClientID:     os.Getenv("TWITTER_CLIENT_ID"),
 			TwitterClientSecret: os.Getenv("TWITTER_CLIENT_SECRET"),
 			TwitterRedirectURI:  os.Getenv("TWITTER_REDIRECT_URI"),
+			TwitterCheckTimeout: getEnvDuration("TWITTER_CHECK_TIMEOUT", checkTimeout),
+			TwitterAuthBaseURL:  upstreamURL("TWITTER_AUTH_BASE_URL", "https://twitter.com", "/twitter"),
+			TwitterAPIBaseURL:   upstreamURL("TWITTER_API_BASE_URL", "https://api.twitter.com", "/twitter"),
 
 			// Tiktok
 			TiktokClientID:     os.Getenv("TIKTOK_CLIENT_ID"),
 			TiktokClientSecret: os.Getenv("TIKTOK_CLIENT_SECRET"),
 			TiktokRedirectURI:  os.Getenv("TIKTOK_REDIRECT_URI"),
+			TiktokCheckTimeout: getEnvDuration("TIKTOK_CHECK_TIMEOUT", checkTimeout),
+			TiktokAuthBaseURL:  upstreamURL("TIKTOK_AUTH_BASE_URL", "https://www.tiktok.com", "/tiktok"),
+			TiktokAPIBaseURL:   upstreamURL("TIKTOK_API_BASE_URL", "https://open.tiktokapis.com", "/tiktok"),
+		}
+
+		if sandbox {
+			applySandboxDefaults(&config)
 		}
 	})
 
 	return &config
 }
 
+// applySandboxDefaults fills in the credentials, callbacks and targets the built-in sandbox scenario
+// works with, so sandbox mode runs without any platform settings
+func applySandboxDefaults(cfg *Config) {
+	callback := func(platform string) string {
+		return "http://localhost:" + cfg.Port + "/" + platform + "/callback"
+	}
+	defaults := []struct {
+		value    *string
+		fallback string
+	}{
+		{&cfg.YouTubeClientID, "sandbox-google-client"},
+		{&cfg.YouTubeClientSecret, "sandbox-google-secret"},
+		{&cfg.YouTubeRedirectURL, callback("youtube")},
+		{&cfg.YouTubeChannelID, "UCsandboxChannel00000001"},
+		{&cfg.YouTubeAPIKey, "sandbox-api-key"},
+		{&cfg.MetaAppID, "sandbox-meta-app"},
+		{&cfg.MetaAppSecret, "sandbox-meta-secret"},
+		{&cfg.MetaRedirectURI, callback("facebook")},
+		{&cfg.InstagramRedirectURI, callback("instagram")},
+		{&cfg.DiscordClientID, "sandbox-discord-client"},
+		{&cfg.DiscordClientSecret, "sandbox-discord-secret"},
+		{&cfg.DiscordRedirectURI, callback("discord")},
+		{&cfg.DiscordServerID, "900000000000000001"},
+		{&cfg.DiscordBotToken, "sandbox-discord-bot"},
+		{&cfg.TwitterClientID, "sandbox-twitter-client"},
+		{&cfg.TwitterClientSecret, "sandbox-twitter-secret"},
+		{&cfg.TwitterRedirectURI, callback("twitter")},
+		{&cfg.TiktokClientID, "sandbox-tiktok-client"},
+		{&cfg.TiktokClientSecret, "sandbox-tiktok-secret"},
+		{&cfg.TiktokRedirectURI, callback("tiktok")},
+	}
+	for _, d := range defaults {
+		if *d.value == "" {
+			*d.value = d.fallback
+		}
+	}
+}
+
 // getEnvOrDefault returns the environment variable value or a default if not set
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -87,3 +287,38 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvBool returns the environment variable parsed as a bool or a default if not set or invalid
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvInt returns the environment variable parsed as an int or a default if not set or invalid
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvDuration returns the environment variable parsed as a duration or a default if not set or invalid
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvList returns the comma-separated values of an environment variable
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
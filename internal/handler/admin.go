@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"hej/internal/config"
+	"hej/internal/platform"
+	"hej/pkg/utils"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxMemberCheckUsers is the number of users a bulk Discord member check accepts at once
+const maxMemberCheckUsers = 100
+
+// memberCheckBatchTimeout bounds a whole bulk Discord member check, so the response is written before
+// the server's write timeout however many users are slow to check
+const memberCheckBatchTimeout = 8 * time.Second
+
+// StatusResponse reports the health of the upstream platforms
+type StatusResponse struct {
+	Breakers       []platform.BreakerStatus           `json:"breakers"`
+	RateLimits     []platform.RateLimitBudget         `json:"rateLimits"`
+	DiscordMembers *platform.DiscordMemberIndexStatus `json:"discordMembers,omitempty"`
+}
+
+// MemberCheckRequest is the body of a bulk Discord member check
+type MemberCheckRequest struct {
+	Users []string `json:"users"` // Discord user IDs
+}
+
+// MemberCheckResult is the outcome of the member check of one user, with either a result or an error
+type MemberCheckResult struct {
+	User   string         `json:"user"`
+	Result *CheckResponse `json:"result,omitempty"`
+	Error  string         `json:"error,omitempty"`
+	Code   string         `json:"code,omitempty"`
+}
+
+// AdminHandler handles operator requests
+type AdminHandler struct {
+	cfg *config.Config
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(cfg *config.Config) *AdminHandler {
+	return &AdminHandler{
+		cfg: cfg,
+	}
+}
+
+// Status reports the circuit breaker state and tracked rate-limit budgets of every platform
+func (h *AdminHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(w, r) {
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, StatusResponse{
+		Breakers:       platform.BreakerStates(),
+		RateLimits:     platform.RateLimitBudgets(),
+		DiscordMembers: platform.DiscordMemberIndexState(),
+	})
+}
+
+// CheckDiscordMembers re-verifies the membership of known Discord users with the bot token, without
+// their logins. Every user gets a result or an error of their own; users not checked before the
+// batch deadline get a timeout.
+func (h *AdminHandler) CheckDiscordMembers(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(w, r) {
+		return
+	}
+	if h.cfg.DiscordBotToken == "" {
+		utils.RespondWithError(w, http.StatusNotFound, "Discord bot is not configured")
+		return
+	}
+
+	var req MemberCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if len(req.Users) == 0 || len(req.Users) > maxMemberCheckUsers {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Between 1 and %d users are required", maxMemberCheckUsers))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), memberCheckBatchTimeout)
+	defer cancel()
+
+	service := platform.NewDiscordBotService(h.cfg)
+	results := make([]MemberCheckResult, 0, len(req.Users))
+	batchTimedOut := fmt.Sprintf("Not checked within the batch deadline of %s", memberCheckBatchTimeout)
+	for _, user := range req.Users {
+		entry := MemberCheckResult{User: user}
+		if ctx.Err() != nil {
+			entry.Error, entry.Code = batchTimedOut, "timeout"
+			results = append(results, entry)
+			continue
+		}
+
+		result, err := service.ForUser(user).CheckFollower(ctx, h.cfg.DiscordServerID)
+		if err != nil && ctx.Err() != nil {
+			entry.Error, entry.Code = batchTimedOut, "timeout"
+		} else if err != nil {
+			log.Printf("Failed to check Discord member %s: %v", user, err)
+			_, code, reason := checkErrorCode(err)
+			entry.Error, entry.Code = cmp.Or(reason, "Failed to check member"), code
+		} else {
+			response := newCheckResponse("discord", h.cfg.DiscordServerID, checkTypeMembership, result)
+			entry.Result = &response
+		}
+		results = append(results, entry)
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"results": results,
+	})
+}
+
+// authorized checks the request's admin token.
+// It writes an error response and returns false if the request may not use the admin endpoints.
+func (h *AdminHandler) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if h.cfg.AdminToken == "" {
+		utils.RespondWithError(w, http.StatusNotFound, "Admin endpoints are disabled")
+		return false
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.AdminToken)) != 1 {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Invalid admin token")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"encoding/json"
+	"hej/internal/config"
+	"hej/internal/platform"
+	"hej/pkg/utils"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Check types accepted by the versioned check API
+const (
+	checkTypeSubscription = "subscription"
+	checkTypeFollow       = "follow"
+	checkTypeMembership   = "membership"
+	checkTypeEngagement   = "engagement"
+)
+
+// CheckRequest is the body of a versioned check request
+type CheckRequest struct {
+	Target    string `json:"target"`
+	CheckType string `json:"checkType"`
+
+	// User identifies the user by platform ID or handle for a check of public data without a login
+	User string `json:"user"`
+}
+
+// CheckResponse is the result of a versioned check, identical for every platform
+type CheckResponse struct {
+	Status    platform.CheckStatus   `json:"status"`
+	Platform  string                 `json:"platform"`
+	Target    string                 `json:"target"`
+	CheckedAt time.Time              `json:"checkedAt"`
+	Details   map[string]interface{} `json:"details"`
+}
+
+// checkPlatform describes how the versioned check API runs a check on one platform
+type checkPlatform struct {
+	checkType   string
+	authService func(cfg *config.Config) platform.AuthService
+	checker     func(tokenSource oauth2.TokenSource, cfg *config.Config) platform.FollowerChecker
+
+	// fixedTarget returns the target configured on the server, for platforms that do not accept one per request
+	fixedTarget func(cfg *config.Config) string
+
+	// defaultTarget returns the target configured on the server, for requests that do not name one
+	defaultTarget func(cfg *config.Config) string
+
+	// publicChecker returns a checker for users identified in the request instead of by a session,
+	// or nil when the platform does not support it or it is not configured
+	publicChecker func(cfg *config.Config) platform.PublicChecker
+}
+
+// checkPlatforms lists the platforms available through the versioned check API
+var checkPlatforms = map[string]checkPlatform{
+	"youtube": {
+		checkType: checkTypeSubscription,
+		authService: func(cfg *config.Config) platform.AuthService {
+			return platform.NewYouTubeAuthService(cfg)
+		},
+		checker: func(tokenSource oauth2.TokenSource, cfg *config.Config) platform.FollowerChecker {
+			return platform.NewYouTubeService(tokenSource, cfg)
+		},
+		defaultTarget: func(cfg *config.Config) string { return cfg.YouTubeChannelID },
+		publicChecker: func(cfg *config.Config) platform.PublicChecker {
+			if cfg.YouTubeAPIKey == "" {
+				return nil
+			}
+			return platform.NewYouTubePublicService(cfg)
+		},
+	},
+	"facebook": {
+		checkType: checkTypeFollow,
+		authService: func(cfg *config.Config) platform.AuthService {
+			return platform.NewFacebookAuthService(cfg)
+		},
+		checker: func(tokenSource oauth2.TokenSource, cfg *config.Config) platform.FollowerChecker {
+			return platform.NewFacebookService(tokenSource, cfg)
+		},
+	},
+	"instagram": {
+		checkType: checkTypeEngagement,
+		authService: func(cfg *config.Config) platform.AuthService {
+			return platform.NewInstagramAuthService(cfg)
+		},
+		checker: func(tokenSource oauth2.TokenSource, cfg *config.Config) platform.FollowerChecker {
+			return platform.NewInstagramService(tokenSource, cfg)
+		},
+	},
+	"discord": {
+		checkType: checkTypeMembership,
+		authService: func(cfg *config.Config) platform.AuthService {
+			return platform.NewDiscordAuthService(cfg)
+		},
+		checker: func(tokenSource oauth2.TokenSource, cfg *config.Config) platform.FollowerChecker {
+			return platform.NewDiscordService(tokenSource, cfg)
+		},
+		fixedTarget: func(cfg *config.Config) string { return cfg.DiscordServerID },
+	},
+	"twitter": {
+		checkType: checkTypeFollow,
+		authService: func(cfg *config.Config) platform.AuthService {
+			return platform.NewTwitterAuthService(cfg)
+		},
+		checker: func(tokenSource oauth2.TokenSource, cfg *config.Config) platform.FollowerChecker {
+			return platform.NewTwitterService(tokenSource, cfg)
+		},
+	},
+	"tiktok": {
+		checkType: checkTypeFollow,
+		authService: func(cfg *config.Config) platform.AuthService {
+			return platform.NewTiktokAuthService(cfg)
+		},
+		checker: func(tokenSource oauth2.TokenSource, cfg *config.Config) platform.FollowerChecker {
+			return platform.NewTiktokService(tokenSource, cfg)
+		},
+	},
+}
+
+// CheckHandler serves the versioned check API
+type CheckHandler struct {
+	cfg *config.Config
+}
+
+// NewCheckHandler creates a new check handler
+func NewCheckHandler(cfg *config.Config) *CheckHandler {
+	return &CheckHandler{
+		cfg: cfg,
+	}
+}
+
+// Check runs a check for the platform in the path and returns the result in the unified schema
+func (h *CheckHandler) Check(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("platform")
+	p, ok := checkPlatforms[name]
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "Unknown platform: "+name)
+		return
+	}
+
+	var req CheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if req.CheckType != "" && req.CheckType != p.checkType {
+		utils.RespondWithError(w, http.StatusBadRequest, "Unsupported check type for "+name+": "+req.CheckType)
+		return
+	}
+
+	target := req.Target
+	if p.fixedTarget != nil {
+		fixed := p.fixedTarget(h.cfg)
+		if target != "" && target != fixed {
+			utils.RespondWithError(w, http.StatusBadRequest, "The target for "+name+" is configured by the server")
+			return
+		}
+		target = fixed
+	} else {
+		if target == "" && p.defaultTarget != nil {
+			target = p.defaultTarget(h.cfg)
+		}
+		if target == "" {
+			utils.RespondWithError(w, http.StatusBadRequest, "Target is required")
+			return
+		}
+	}
+
+	var result *platform.CheckResult
+	var err error
+	if req.User != "" {
+		var checker platform.PublicChecker
+		if p.publicChecker != nil {
+			checker = p.publicChecker(h.cfg)
+		}
+		if checker == nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Checks without a login are not available for "+name)
+			return
+		}
+		result, err = checker.CheckPublic(r.Context(), req.User, target)
+	} else {
+		tokenSource, ok := sessionTokenSource(w, r, p.authService(h.cfg))
+		if !ok {
+			return
+		}
+		result, err = p.checker(tokenSource, h.cfg).CheckFollower(r.Context(), target)
+	}
+	if err != nil {
+		respondWithCheckError(w, "Failed to check "+name, err)
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, newCheckResponse(name, target, p.checkType, result))
+}
+
+// newCheckResponse converts a platform check result to the unified response schema
+func newCheckResponse(name, target, checkType string, result *platform.CheckResult) CheckResponse {
+	details := map[string]interface{}{
+		"checkType": checkType,
+		"reason":    result.Reason,
+		"evidence":  result.Evidence,
+	}
+	if result.UserID != "" {
+		details["userId"] = result.UserID
+	}
+	if result.TargetID != "" {
+		details["targetId"] = result.TargetID
+	}
+	if result.Since != nil {
+		details["since"] = result.Since
+	}
+	if result.Member != nil {
+		details["member"] = result.Member
+	}
+
+	return CheckResponse{
+		Status:    result.Status,
+		Platform:  name,
+		Target:    target,
+		CheckedAt: result.CheckedAt,
+		Details:   details,
+	}
+}
+
+// Deprecated marks a legacy route as deprecated in favour of its versioned successor
+func Deprecated(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		next(w, r)
+	}
+}
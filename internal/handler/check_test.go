@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"hej/internal/config"
+)
+
+func TestCheckRequiresTarget(t *testing.T) {
+	h := NewCheckHandler(&config.Config{})
+
+	r := httptest.NewRequest("POST", "/v1/tiktok/check", strings.NewReader(`{"checkType": "follow"}`))
+	r.SetPathValue("platform", "tiktok")
+	r.Header.Set("Authorization", "Bearer session")
+	w := httptest.NewRecorder()
+	h.Check(w, r)
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Target is required") {
+		t.Errorf("check without a target = %d %s, want 400 Target is required", w.Code, w.Body)
+	}
+}
@@ -22,45 +22,63 @@ func NewDiscordHandler(cfg *config.Config) *DiscordHandler {
 // Login handles the Discord auth login request
 func (h *DiscordHandler) Login(w http.ResponseWriter, r *http.Request) {
 	authService := platform.NewDiscordAuthService(h.cfg)
-	http.Redirect(w, r, authService.GetAuthURL(), http.StatusTemporaryRedirect)
+	beginLogin(w, r, h.cfg, "discord", authService)
 }
 
 // Callback handles the Discord auth callback
 func (h *DiscordHandler) Callback(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Code not found")
+	authService := platform.NewDiscordAuthService(h.cfg)
+	completeLogin(w, r, "discord", authService)
+}
+
+// Logout ends a Discord session and deletes its stored token
+func (h *DiscordHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	authService := platform.NewDiscordAuthService(h.cfg)
+	endSession(w, r, authService)
+}
+
+// Revoke disconnects a Discord account by revoking its token with Discord and deleting the stored copy
+func (h *DiscordHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	authService := platform.NewDiscordAuthService(h.cfg)
+	revokeSession(w, r, authService)
+}
+
+// CheckServerMembership checks if a user is a member of a specific Discord server
+func (h *DiscordHandler) CheckServerMembership(w http.ResponseWriter, r *http.Request) {
+
+	authService := platform.NewDiscordAuthService(h.cfg)
+	tokenSource, ok := sessionTokenSource(w, r, authService)
+	if !ok {
 		return
 	}
 
-	authService := platform.NewDiscordAuthService(h.cfg)
-	token, err := authService.ExchangeToken(code)
+	service := platform.NewDiscordService(tokenSource, h.cfg)
+	result, err := service.CheckFollower(r.Context(), "")
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to exchange code: "+err.Error())
+		respondWithCheckError(w, "Failed to check server membership", err)
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, map[string]string{
-		"accessToken": token,
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"isMember": result.Status == platform.StatusYes,
+		"result":   result,
 	})
 }
 
-// CheckServerMembership checks if a user is a member of a specific Discord server
-func (h *DiscordHandler) CheckServerMembership(w http.ResponseWriter, r *http.Request) {
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Token is required")
+// TokenInfo reports the identity, granted scopes and expiry of the session's Discord token
+func (h *DiscordHandler) TokenInfo(w http.ResponseWriter, r *http.Request) {
+	authService := platform.NewDiscordAuthService(h.cfg)
+	tokenSource, ok := sessionTokenSource(w, r, authService)
+	if !ok {
 		return
 	}
 
-	service := platform.NewDiscordService(token, h.cfg)
-	isMember, err := service.IsFollower("")
+	service := platform.NewDiscordService(tokenSource, h.cfg)
+	info, err := service.TokenInfo(r.Context())
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to check server membership: "+err.Error())
+		respondWithCheckError(w, "Failed to get token info", err)
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"isMember": isMember,
-	})
+	utils.RespondWithJSON(w, http.StatusOK, info)
 }
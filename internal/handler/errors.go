@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"errors"
+	"hej/internal/auth"
+	"hej/internal/platform"
+	"hej/pkg/utils"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// checkErrors maps the errors a platform check can fail with to an HTTP status and a stable error code
+var checkErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{auth.ErrReauthorizationRequired, http.StatusUnauthorized, "reauthorization_required"},
+	{platform.ErrTokenInvalid, http.StatusUnauthorized, "token_invalid"},
+	{platform.ErrMissingScope, http.StatusForbidden, "missing_scope"},
+	{platform.ErrFollowingPrivate, http.StatusForbidden, "following_private"},
+	{platform.ErrTargetNotFound, http.StatusNotFound, "target_not_found"},
+	{platform.ErrInvalidTarget, http.StatusBadRequest, "invalid_target"},
+	{platform.ErrRateLimited, http.StatusTooManyRequests, "rate_limited"},
+	{platform.ErrUpstreamUnavailable, http.StatusServiceUnavailable, "upstream_unavailable"},
+}
+
+// respondWithCheckError sends the error response for a failed platform check.
+// Clients get a status, a machine-readable code and a message naming the kind of failure;
+// the full error, including anything a platform sent back, is only logged.
+func respondWithCheckError(w http.ResponseWriter, message string, err error) {
+	log.Printf("%s: %v", message, err)
+
+	if retryAfter := platform.RetryAfter(err); retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+
+	status, code, reason := checkErrorCode(err)
+	if reason == "" {
+		respondWithErrorCode(w, status, code, message)
+		return
+	}
+	respondWithErrorCode(w, status, code, message+": "+reason)
+}
+
+// checkErrorCode returns the HTTP status and error code for a failed platform check and the kind
+// of failure that is safe to show to clients, which is empty for unexpected errors
+func checkErrorCode(err error) (int, string, string) {
+	var timeout *platform.TimeoutError
+	if errors.As(err, &timeout) {
+		return http.StatusGatewayTimeout, "timeout", timeout.Error()
+	}
+
+	for _, e := range checkErrors {
+		if errors.Is(err, e.err) {
+			return e.status, e.code, e.err.Error()
+		}
+	}
+
+	var apiErr *platform.APIError
+	if errors.As(err, &apiErr) {
+		return http.StatusBadGateway, "upstream_error", apiErr.Error()
+	}
+
+	return http.StatusInternalServerError, "internal_error", ""
+}
+
+// respondWithErrorCode sends an error response with a machine-readable code
+func respondWithErrorCode(w http.ResponseWriter, status int, code, message string) {
+	utils.RespondWithJSON(w, status, map[string]string{
+		"error": message,
+		"code":  code,
+	})
+}
@@ -22,36 +22,29 @@ func NewFacebookHandler(cfg *config.Config) *FacebookHandler {
 // Login handles the Facebook auth login request
 func (h *FacebookHandler) Login(w http.ResponseWriter, r *http.Request) {
 	authService := platform.NewFacebookAuthService(h.cfg)
-	http.Redirect(w, r, authService.GetAuthURL(), http.StatusTemporaryRedirect)
+	beginLogin(w, r, h.cfg, "facebook", authService)
 }
 
 // Callback handles the Facebook auth callback
 func (h *FacebookHandler) Callback(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Code not found")
-		return
-	}
+	authService := platform.NewFacebookAuthService(h.cfg)
+	completeLogin(w, r, "facebook", authService)
+}
 
+// Logout ends a Facebook session and deletes its stored token
+func (h *FacebookHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	authService := platform.NewFacebookAuthService(h.cfg)
-	token, err := authService.ExchangeToken(code)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to exchange code: "+err.Error())
-		return
-	}
+	endSession(w, r, authService)
+}
 
-	utils.RespondWithJSON(w, http.StatusOK, map[string]string{
-		"accessToken": token,
-	})
+// Revoke disconnects a Facebook account by revoking its token with Facebook and deleting the stored copy
+func (h *FacebookHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	authService := platform.NewFacebookAuthService(h.cfg)
+	revokeSession(w, r, authService)
 }
 
 // CheckFollower checks if a user follows a Facebook profile
 func (h *FacebookHandler) CheckFollower(w http.ResponseWriter, r *http.Request) {
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Token is required")
-		return
-	}
 
 	targetID := r.URL.Query().Get("targetId")
 	if targetID == "" {
@@ -59,14 +52,39 @@ func (h *FacebookHandler) CheckFollower(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	service := platform.NewFacebookService(token, h.cfg)
-	isFollowing, err := service.IsFollower(targetID)
+	authService := platform.NewFacebookAuthService(h.cfg)
+	tokenSource, ok := sessionTokenSource(w, r, authService)
+	if !ok {
+		return
+	}
+
+	service := platform.NewFacebookService(tokenSource, h.cfg)
+	result, err := service.CheckFollower(r.Context(), targetID)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to check follower status: "+err.Error())
+		respondWithCheckError(w, "Failed to check follower status", err)
 		return
 	}
 
 	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"isFollowing": isFollowing,
+		"isFollowing": result.Status == platform.StatusYes,
+		"result":      result,
 	})
 }
+
+// TokenInfo reports the identity, granted scopes and expiry of the session's Facebook token
+func (h *FacebookHandler) TokenInfo(w http.ResponseWriter, r *http.Request) {
+	authService := platform.NewFacebookAuthService(h.cfg)
+	tokenSource, ok := sessionTokenSource(w, r, authService)
+	if !ok {
+		return
+	}
+
+	service := platform.NewFacebookService(tokenSource, h.cfg)
+	info, err := service.TokenInfo(r.Context())
+	if err != nil {
+		respondWithCheckError(w, "Failed to get token info", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, info)
+}
@@ -22,36 +22,29 @@ func NewInstagramHandler(cfg *config.Config) *InstagramHandler {
 // Login handles the Instagram auth login request
 func (h *InstagramHandler) Login(w http.ResponseWriter, r *http.Request) {
 	authService := platform.NewInstagramAuthService(h.cfg)
-	http.Redirect(w, r, authService.GetAuthURL(), http.StatusTemporaryRedirect)
+	beginLogin(w, r, h.cfg, "instagram", authService)
 }
 
 // Callback handles the Instagram auth callback
 func (h *InstagramHandler) Callback(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Code not found")
-		return
-	}
+	authService := platform.NewInstagramAuthService(h.cfg)
+	completeLogin(w, r, "instagram", authService)
+}
 
+// Logout ends a Instagram session and deletes its stored token
+func (h *InstagramHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	authService := platform.NewInstagramAuthService(h.cfg)
-	token, err := authService.ExchangeToken(code)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to exchange code: "+err.Error())
-		return
-	}
+	endSession(w, r, authService)
+}
 
-	utils.RespondWithJSON(w, http.StatusOK, map[string]string{
-		"accessToken": token,
-	})
+// Revoke disconnects a Instagram account by revoking its token with Instagram and deleting the stored copy
+func (h *InstagramHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	authService := platform.NewInstagramAuthService(h.cfg)
+	revokeSession(w, r, authService)
 }
 
 // CheckFollower checks if a user follows an Instagram account
 func (h *InstagramHandler) CheckFollower(w http.ResponseWriter, r *http.Request) {
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Token is required")
-		return
-	}
 
 	targetUsername := r.URL.Query().Get("username")
 	if targetUsername == "" {
@@ -59,14 +52,39 @@ func (h *InstagramHandler) CheckFollower(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	service := platform.NewInstagramService(token, h.cfg)
-	isFollowing, err := service.IsFollower(targetUsername)
+	authService := platform.NewInstagramAuthService(h.cfg)
+	tokenSource, ok := sessionTokenSource(w, r, authService)
+	if !ok {
+		return
+	}
+
+	service := platform.NewInstagramService(tokenSource, h.cfg)
+	result, err := service.CheckFollower(r.Context(), targetUsername)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to check follower status: "+err.Error())
+		respondWithCheckError(w, "Failed to check follower status", err)
 		return
 	}
 
 	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"isFollowing": isFollowing,
+		"isFollowing": result.Status == platform.StatusYes,
+		"result":      result,
 	})
 }
+
+// TokenInfo reports the identity, granted scopes and expiry of the session's Instagram token
+func (h *InstagramHandler) TokenInfo(w http.ResponseWriter, r *http.Request) {
+	authService := platform.NewInstagramAuthService(h.cfg)
+	tokenSource, ok := sessionTokenSource(w, r, authService)
+	if !ok {
+		return
+	}
+
+	service := platform.NewInstagramService(tokenSource, h.cfg)
+	info, err := service.TokenInfo(r.Context())
+	if err != nil {
+		respondWithCheckError(w, "Failed to get token info", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, info)
+}
@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"errors"
+	"hej/internal/auth"
+	"hej/internal/config"
+	"hej/internal/platform"
+	"hej/pkg/utils"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// stateCookiePrefix is prepended to the provider name to form the state cookie name
+const stateCookiePrefix = "oauth_state_"
+
+// Response modes for delivering the result of a login
+const (
+	responseModeJSON     = "json"     // respond to the callback with a JSON body
+	responseModeQuery    = "query"    // redirect to return_to with the result in the query string, only on request
+	responseModeFragment = "fragment" // redirect to return_to with the result in the URL fragment
+	responseModePopup    = "popup"    // render a page that posts the result to window.opener
+)
+
+// Error codes delivered to the client application when a login fails
+const (
+	loginErrorStateMissing  = "state_missing"
+	loginErrorStateMismatch = "state_mismatch"
+	loginErrorStateInvalid  = "state_invalid"
+	loginErrorStateExpired  = "state_expired"
+	loginErrorStateReplayed = "state_replayed"
+	loginErrorCodeMissing   = "code_missing"
+	loginErrorExchange      = "exchange_failed"
+)
+
+// loginResult is the outcome of a login delivered to the client application
+type loginResult struct {
+	Platform  string `json:"platform"`
+	SessionID string `json:"sessionId,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// beginLogin redirects the browser to the provider and binds the issued state to it with a cookie.
+// The optional return_to and response_mode parameters choose how the result is delivered.
+func beginLogin(w http.ResponseWriter, r *http.Request, cfg *config.Config, provider string, authService platform.AuthService) {
+	opts, err := loginOptions(r, cfg.ReturnToAllowlist)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authURL, state := authService.GetAuthURL(opts)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookiePrefix + provider,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int(auth.StateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
+}
+
+// loginOptions validates the return_to and response_mode parameters of a login request
+func loginOptions(r *http.Request, allowlist []string) (auth.LoginOptions, error) {
+	returnTo := r.URL.Query().Get("return_to")
+	mode := r.URL.Query().Get("response_mode")
+
+	if returnTo == "" {
+		if mode != "" && mode != responseModeJSON {
+			return auth.LoginOptions{}, errors.New("return_to is required for response_mode " + mode)
+		}
+		return auth.LoginOptions{ResponseMode: responseModeJSON}, nil
+	}
+
+	if !isAllowedReturnTo(returnTo, allowlist) {
+		return auth.LoginOptions{}, errors.New("return_to is not allowed")
+	}
+
+	// The session ID is a credential, so it only goes in the query string, where it would reach
+	// server logs and Referer headers, when the client asks for it
+	switch mode {
+	case "":
+		mode = responseModeFragment
+	case responseModeQuery, responseModeFragment, responseModePopup:
+	default:
+		return auth.LoginOptions{}, errors.New("response_mode must be one of json, query, fragment or popup")
+	}
+
+	return auth.LoginOptions{ReturnTo: returnTo, ResponseMode: mode}, nil
+}
+
+// isAllowedReturnTo reports whether a URL matches an allowlisted prefix.
+// Scheme and host must match exactly and the path must be the allowlisted path or below it.
+func isAllowedReturnTo(returnTo string, allowlist []string) bool {
+	target, err := url.Parse(returnTo)
+	if err != nil || target.User != nil || (target.Scheme != "https" && target.Scheme != "http") {
+		return false
+	}
+
+	for _, entry := range allowlist {
+		allowed, err := url.Parse(entry)
+		if err != nil {
+			continue
+		}
+		if target.Scheme != allowed.Scheme || target.Host != allowed.Host {
+			continue
+		}
+		prefix := strings.TrimSuffix(allowed.Path, "/")
+		if target.Path == prefix || strings.HasPrefix(target.Path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// completeLogin validates the callback state, exchanges the code for a token and
+// delivers the new session ID, or an error code, in the response mode chosen at login
+func completeLogin(w http.ResponseWriter, r *http.Request, provider string, authService platform.AuthService) {
+	// The signed state tells us where to deliver the result before anything else is checked
+	opts, err := authService.ParseState(r.URL.Query().Get("state"))
+	if err != nil {
+		respondWithStateError(w, err)
+		return
+	}
+
+	fail := func(status int, code, message string) {
+		respondWithLogin(w, r, *opts, status, loginResult{Platform: provider, Error: code}, message)
+	}
+
+	state, err := callbackState(w, r, provider)
+	if err != nil {
+		fail(stateErrorStatus(err), stateErrorCode(err), "Invalid OAuth state: "+err.Error())
+		return
+	}
+
+	// The provider reports a denied or failed authorization in the error parameter
+	if providerError := r.URL.Query().Get("error"); providerError != "" {
+		fail(http.StatusBadRequest, providerError, "Authorization failed: "+providerError)
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		fail(http.StatusBadRequest, loginErrorCodeMissing, "Code not found")
+		return
+	}
+
+	sessionID, err := authService.ExchangeToken(r.Context(), code, state)
+	if err != nil {
+		if auth.IsStateError(err) {
+			fail(stateErrorStatus(err), stateErrorCode(err), "Invalid OAuth state: "+err.Error())
+			return
+		}
+		// Token endpoint errors can echo request details, so they are only logged
+		log.Printf("%s: failed to exchange code: %v", provider, err)
+		fail(http.StatusInternalServerError, loginErrorExchange, "Failed to exchange code")
+		return
+	}
+
+	respondWithLogin(w, r, *opts, http.StatusOK, loginResult{Platform: provider, SessionID: sessionID}, "")
+}
+
+// respondWithLogin delivers a login result in the given response mode.
+// For JSON responses a failed login is sent as an error with the given message.
+func respondWithLogin(w http.ResponseWriter, r *http.Request, opts auth.LoginOptions, status int, result loginResult, message string) {
+	switch opts.ResponseMode {
+	case responseModeQuery, responseModeFragment:
+		http.Redirect(w, r, resultURL(opts, result), http.StatusFound)
+	case responseModePopup:
+		respondWithPopup(w, opts.ReturnTo, result)
+	default:
+		if result.Error != "" {
+			utils.RespondWithJSON(w, status, map[string]string{
+				"error": message,
+				"code":  result.Error,
+			})
+			return
+		}
+		utils.RespondWithJSON(w, status, map[string]string{
+			"sessionId": result.SessionID,
+		})
+	}
+}
+
+// resultURL adds a login result to the return_to URL's query string or fragment
+func resultURL(opts auth.LoginOptions, result loginResult) string {
+	target, _ := url.Parse(opts.ReturnTo)
+
+	values := url.Values{"platform": {result.Platform}}
+	if result.Error != "" {
+		values.Set("error", result.Error)
+	} else {
+		values.Set("session_id", result.SessionID)
+	}
+
+	if opts.ResponseMode == responseModeFragment {
+		target.Fragment = values.Encode()
+		return target.String()
+	}
+
+	query := target.Query()
+	for key, value := range values {
+		query[key] = value
+	}
+	target.RawQuery = query.Encode()
+	return target.String()
+}
+
+// popupTemplate posts the login result to the window that opened the popup and closes it
+var popupTemplate = template.Must(template.New("popup").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Login complete</title></head>
+<body>
+<script>
+(function () {
+	var result = {{.Result}};
+	if (window.opener) {
+		window.opener.postMessage({type: "oauth_result", result: result}, {{.Origin}});
+	}
+	window.close();
+})();
+</script>
+</body>
+</html>
+`))
+
+// respondWithPopup renders the popup page, restricting the message to the return_to origin
+func respondWithPopup(w http.ResponseWriter, returnTo string, result loginResult) {
+	target, _ := url.Parse(returnTo)
+	origin := target.Scheme + "://" + target.Host
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	popupTemplate.Execute(w, map[string]interface{}{
+		"Result": result,
+		"Origin": origin,
+	})
+}
+
+// callbackState returns the state of a callback request once it matches the browser's state cookie.
+// The cookie is cleared so the state cannot be submitted again from the same browser.
+func callbackState(w http.ResponseWriter, r *http.Request, provider string) (string, error) {
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		return "", auth.ErrStateMissing
+	}
+
+	cookie, err := r.Cookie(stateCookiePrefix + provider)
+	if err != nil || cookie.Value != state {
+		return "", auth.ErrStateMismatch
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookiePrefix + provider,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return state, nil
+}
+
+// respondWithStateError sends a 4xx JSON response for an OAuth state validation error
+func respondWithStateError(w http.ResponseWriter, err error) {
+	respondWithErrorCode(w, stateErrorStatus(err), stateErrorCode(err), "Invalid OAuth state: "+err.Error())
+}
+
+// stateErrorStatus returns the HTTP status for an OAuth state validation error
+func stateErrorStatus(err error) int {
+	if errors.Is(err, auth.ErrStateMissing) {
+		return http.StatusBadRequest
+	}
+	return http.StatusForbidden
+}
+
+// stateErrorCode returns the login error code for an OAuth state validation error
+func stateErrorCode(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrStateMissing):
+		return loginErrorStateMissing
+	case errors.Is(err, auth.ErrStateMismatch):
+		return loginErrorStateMismatch
+	case errors.Is(err, auth.ErrStateExpired):
+		return loginErrorStateExpired
+	case errors.Is(err, auth.ErrStateReplayed):
+		return loginErrorStateReplayed
+	default:
+		return loginErrorStateInvalid
+	}
+}
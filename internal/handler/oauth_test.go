@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hej/internal/auth"
+)
+
+func TestCallbackState(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   string
+		cookie  string // value of the state cookie, none when empty
+		wantErr error
+	}{
+		{"matching cookie", "issued", "issued", nil},
+		{"no state", "", "issued", auth.ErrStateMissing},
+		{"no cookie", "issued", "", auth.ErrStateMismatch},
+		{"other browser's state", "issued", "another", auth.ErrStateMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/twitter/callback?code=code&state="+tt.state, nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: stateCookiePrefix + "twitter", Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+
+			state, err := callbackState(w, r, "twitter")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("callbackState = %q, %v, want %v", state, err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			cookies := w.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Name != stateCookiePrefix+"twitter" || cookies[0].MaxAge >= 0 {
+				t.Errorf("callbackState set cookies %v, want the state cookie cleared", cookies)
+			}
+		})
+	}
+
+	// A state cookie of another provider does not count
+	r := httptest.NewRequest("GET", "/twitter/callback?state=issued", nil)
+	r.AddCookie(&http.Cookie{Name: stateCookiePrefix + "discord", Value: "issued"})
+	if _, err := callbackState(httptest.NewRecorder(), r, "twitter"); !errors.Is(err, auth.ErrStateMismatch) {
+		t.Errorf("callbackState with another provider's cookie = %v, want ErrStateMismatch", err)
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"hej/internal/auth"
+	"hej/internal/platform"
+	"hej/pkg/utils"
+	"log"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// sessionID returns the session ID sent in the request's Authorization header. Session IDs are
+// bearer credentials and are not read from the URL, which ends up in logs and referrers.
+func sessionID(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	return ""
+}
+
+// sessionTokenSource resolves the request's session to a token source.
+// It writes an error response and returns false if the session cannot be resolved.
+func sessionTokenSource(w http.ResponseWriter, r *http.Request, authService platform.AuthService) (oauth2.TokenSource, bool) {
+	id := sessionID(r)
+	if id == "" {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Session is required")
+		return nil, false
+	}
+
+	tokenSource, err := authService.TokenSource(r.Context(), id)
+	if errors.Is(err, auth.ErrSessionNotFound) {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Session not found")
+		return nil, false
+	}
+	if err != nil {
+		// Storage and decryption errors stay in the log
+		respondWithCheckError(w, "Failed to load session", err)
+		return nil, false
+	}
+
+	return tokenSource, true
+}
+
+// endSession deletes the request's session and its stored token
+func endSession(w http.ResponseWriter, r *http.Request, authService platform.AuthService) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id := sessionID(r)
+	if id == "" {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Session is required")
+		return
+	}
+
+	err := authService.EndSession(id)
+	if errors.Is(err, auth.ErrSessionNotFound) {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Session not found")
+		return
+	}
+	if err != nil {
+		respondWithCheckError(w, "Failed to end session", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeSession revokes the request's session token upstream and deletes it.
+// Repeating the request for a session that is already gone succeeds.
+func revokeSession(w http.ResponseWriter, r *http.Request, authService platform.AuthService) {
+	if r.Method != http.MethodPost {
+		utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id := sessionID(r)
+	if id == "" {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Session is required")
+		return
+	}
+
+	if err := authService.Revoke(r.Context(), id); err != nil {
+		log.Printf("Failed to revoke token: %v", err)
+		respondWithErrorCode(w, http.StatusBadGateway, "revocation_failed", "Failed to revoke token")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"hej/internal/auth"
+	"hej/internal/platform"
+
+	"golang.org/x/oauth2"
+)
+
+// failingAuthService fails session lookups with err
+type failingAuthService struct {
+	platform.AuthService
+	err error
+}
+
+func (s failingAuthService) TokenSource(ctx context.Context, sessionID string) (oauth2.TokenSource, error) {
+	return nil, s.err
+}
+
+func (s failingAuthService) EndSession(sessionID string) error {
+	return s.err
+}
+
+func TestSessionErrorsAreSanitized(t *testing.T) {
+	storageErr := errors.New("failed to decrypt token record 3f2a9c: cipher: message authentication failed")
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"storage error", storageErr, http.StatusInternalServerError, "internal_error"},
+		{"unknown session", auth.ErrSessionNotFound, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		service := failingAuthService{err: tt.err}
+		handlers := map[string]func(w http.ResponseWriter, r *http.Request){
+			"load": func(w http.ResponseWriter, r *http.Request) { sessionTokenSource(w, r, service) },
+			"end":  func(w http.ResponseWriter, r *http.Request) { endSession(w, r, service) },
+		}
+		for name, handle := range handlers {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				r := httptest.NewRequest("POST", "/twitter/logout", nil)
+				r.Header.Set("Authorization", "Bearer session")
+				w := httptest.NewRecorder()
+				handle(w, r)
+
+				if w.Code != tt.wantStatus {
+					t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+				}
+				var body map[string]string
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatalf("decoding body %q: %v", w.Body, err)
+				}
+				if body["code"] != tt.wantCode {
+					t.Errorf("code = %q, want %q", body["code"], tt.wantCode)
+				}
+				if strings.Contains(w.Body.String(), "decrypt") {
+					t.Errorf("body %q leaks the storage error", w.Body)
+				}
+			})
+		}
+	}
+}
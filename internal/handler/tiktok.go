@@ -22,45 +22,65 @@ func NewTiktokHandler(cfg *config.Config) *TiktokHandler {
 // Login handles the Tiktok auth login request
 func (h *TiktokHandler) Login(w http.ResponseWriter, r *http.Request) {
 	authService := platform.NewTiktokAuthService(h.cfg)
-	http.Redirect(w, r, authService.GetAuthURL(), http.StatusTemporaryRedirect)
+	beginLogin(w, r, h.cfg, "tiktok", authService)
 }
 
 // Callback handles the Tiktok auth callback
 func (h *TiktokHandler) Callback(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Code not found")
+	authService := platform.NewTiktokAuthService(h.cfg)
+	completeLogin(w, r, "tiktok", authService)
+}
+
+// Logout ends a Tiktok session and deletes its stored token
+func (h *TiktokHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	authService := platform.NewTiktokAuthService(h.cfg)
+	endSession(w, r, authService)
+}
+
+// Revoke disconnects a Tiktok account by revoking its token with Tiktok and deleting the stored copy
+func (h *TiktokHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	authService := platform.NewTiktokAuthService(h.cfg)
+	revokeSession(w, r, authService)
+}
+
+// CheckFollower checks if a user is a follower of a specific Tiktok user. The username is optional
+// here as it was before the versioned check API, which requires a target.
+func (h *TiktokHandler) CheckFollower(w http.ResponseWriter, r *http.Request) {
+	targetUsername := r.URL.Query().Get("username")
+
+	authService := platform.NewTiktokAuthService(h.cfg)
+	tokenSource, ok := sessionTokenSource(w, r, authService)
+	if !ok {
 		return
 	}
 
-	authService := platform.NewTiktokAuthService(h.cfg)
-	token, err := authService.ExchangeToken(code)
+	service := platform.NewTiktokService(tokenSource, h.cfg)
+	result, err := service.CheckFollower(r.Context(), targetUsername)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to exchange code: "+err.Error())
+		respondWithCheckError(w, "Failed to check follower", err)
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, map[string]string{
-		"accessToken": token,
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"isFollower": result.Status == platform.StatusYes,
+		"result":     result,
 	})
 }
 
-// CheckFollower checks if a user is a follower of a specific Tiktok user
-func (h *TiktokHandler) CheckFollower(w http.ResponseWriter, r *http.Request) {
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Token is required")
+// TokenInfo reports the identity, granted scopes and expiry of the session's Tiktok token
+func (h *TiktokHandler) TokenInfo(w http.ResponseWriter, r *http.Request) {
+	authService := platform.NewTiktokAuthService(h.cfg)
+	tokenSource, ok := sessionTokenSource(w, r, authService)
+	if !ok {
 		return
 	}
 
-	service := platform.NewTiktokService(token, h.cfg)
-	isFollower, err := service.IsFollower("")
+	service := platform.NewTiktokService(tokenSource, h.cfg)
+	info, err := service.TokenInfo(r.Context())
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to check follower: "+err.Error())
+		respondWithCheckError(w, "Failed to get token info", err)
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"isFollower": isFollower,
-	})
+	utils.RespondWithJSON(w, http.StatusOK, info)
 }
@@ -22,36 +22,29 @@ func NewTwitterHandler(cfg *config.Config) *TwitterHandler {
 // Login handles the Twitter auth login request
 func (h *TwitterHandler) Login(w http.ResponseWriter, r *http.Request) {
 	authService := platform.NewTwitterAuthService(h.cfg)
-	http.Redirect(w, r, authService.GetAuthURL(), http.StatusTemporaryRedirect)
+	beginLogin(w, r, h.cfg, "twitter", authService)
 }
 
 // Callback handles the Twitter auth callback
 func (h *TwitterHandler) Callback(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Code not found")
-		return
-	}
+	authService := platform.NewTwitterAuthService(h.cfg)
+	completeLogin(w, r, "twitter", authService)
+}
 
+// Logout ends a Twitter session and deletes its stored token
+func (h *TwitterHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	authService := platform.NewTwitterAuthService(h.cfg)
-	token, err := authService.ExchangeToken(code)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to exchange code: "+err.Error())
-		return
-	}
+	endSession(w, r, authService)
+}
 
-	utils.RespondWithJSON(w, http.StatusOK, map[string]string{
-		"accessToken": token,
-	})
+// Revoke disconnects a Twitter account by revoking its token with Twitter and deleting the stored copy
+func (h *TwitterHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	authService := platform.NewTwitterAuthService(h.cfg)
+	revokeSession(w, r, authService)
 }
 
 // CheckFollower checks if a user follows a Twitter account
 func (h *TwitterHandler) CheckFollower(w http.ResponseWriter, r *http.Request) {
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Token is required")
-		return
-	}
 
 	targetUsername := r.URL.Query().Get("username")
 	if targetUsername == "" {
@@ -59,14 +52,39 @@ func (h *TwitterHandler) CheckFollower(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	service := platform.NewTwitterService(token, h.cfg)
-	isFollowing, err := service.IsFollower(targetUsername)
+	authService := platform.NewTwitterAuthService(h.cfg)
+	tokenSource, ok := sessionTokenSource(w, r, authService)
+	if !ok {
+		return
+	}
+
+	service := platform.NewTwitterService(tokenSource, h.cfg)
+	result, err := service.CheckFollower(r.Context(), targetUsername)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to check follower status: "+err.Error())
+		respondWithCheckError(w, "Failed to check follower status", err)
 		return
 	}
 
 	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"isFollowing": isFollowing,
+		"isFollowing": result.Status == platform.StatusYes,
+		"result":      result,
 	})
 }
+
+// TokenInfo reports the identity, granted scopes and expiry of the session's Twitter token
+func (h *TwitterHandler) TokenInfo(w http.ResponseWriter, r *http.Request) {
+	authService := platform.NewTwitterAuthService(h.cfg)
+	tokenSource, ok := sessionTokenSource(w, r, authService)
+	if !ok {
+		return
+	}
+
+	service := platform.NewTwitterService(tokenSource, h.cfg)
+	info, err := service.TokenInfo(r.Context())
+	if err != nil {
+		respondWithCheckError(w, "Failed to get token info", err)
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, info)
+}
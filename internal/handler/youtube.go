@@ -22,45 +22,65 @@ func NewYouTubeHandler(cfg *config.Config) *YouTubeHandler {
 // Login handles the YouTube auth login request
 func (h *YouTubeHandler) Login(w http.ResponseWriter, r *http.Request) {
 	authService := platform.NewYouTubeAuthService(h.cfg)
-	http.Redirect(w, r, authService.GetAuthURL(), http.StatusTemporaryRedirect)
+	beginLogin(w, r, h.cfg, "youtube", authService)
 }
 
 // Callback handles the YouTube auth callback
 func (h *YouTubeHandler) Callback(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Code not found")
+	authService := platform.NewYouTubeAuthService(h.cfg)
+	completeLogin(w, r, "youtube", authService)
+}
+
+// Logout ends a YouTube session and deletes its stored token
+func (h *YouTubeHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	authService := platform.NewYouTubeAuthService(h.cfg)
+	endSession(w, r, authService)
+}
+
+// Revoke disconnects a YouTube account by revoking its token with YouTube and deleting the stored copy
+func (h *YouTubeHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	authService := platform.NewYouTubeAuthService(h.cfg)
+	revokeSession(w, r, authService)
+}
+
+// CheckSubscription checks if a user is subscribed to a YouTube channel: the one in the channel
+// query parameter, given as a channel ID, @handle, channel URL or video URL, or else the configured one
+func (h *YouTubeHandler) CheckSubscription(w http.ResponseWriter, r *http.Request) {
+	channel := r.URL.Query().Get("channel")
+
+	authService := platform.NewYouTubeAuthService(h.cfg)
+	tokenSource, ok := sessionTokenSource(w, r, authService)
+	if !ok {
 		return
 	}
 
-	authService := platform.NewYouTubeAuthService(h.cfg)
-	token, err := authService.ExchangeToken(code)
+	service := platform.NewYouTubeService(tokenSource, h.cfg)
+	result, err := service.CheckFollower(r.Context(), channel)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to exchange code: "+err.Error())
+		respondWithCheckError(w, "Failed to check subscription", err)
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, map[string]string{
-		"accessToken": token,
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"isSubscribed": result.Status == platform.StatusYes,
+		"result":       result,
 	})
 }
 
-// CheckSubscription checks if a user is subscribed to a YouTube channel
-func (h *YouTubeHandler) CheckSubscription(w http.ResponseWriter, r *http.Request) {
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Token is required")
+// TokenInfo reports the identity, granted scopes and expiry of the session's YouTube token
+func (h *YouTubeHandler) TokenInfo(w http.ResponseWriter, r *http.Request) {
+	authService := platform.NewYouTubeAuthService(h.cfg)
+	tokenSource, ok := sessionTokenSource(w, r, authService)
+	if !ok {
 		return
 	}
 
-	service := platform.NewYouTubeService(token, h.cfg)
-	isSubscribed, err := service.IsFollower("")
+	service := platform.NewYouTubeService(tokenSource, h.cfg)
+	info, err := service.TokenInfo(r.Context())
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to check subscription: "+err.Error())
+		respondWithCheckError(w, "Failed to get token info", err)
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"isSubscribed": isSubscribed,
-	})
+	utils.RespondWithJSON(w, http.StatusOK, info)
 }
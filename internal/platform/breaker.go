@@ -0,0 +1,188 @@
+package platform
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a platform's circuit breaker
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // requests are sent normally
+	BreakerOpen     BreakerState = "open"      // requests fail fast until the cooldown has passed
+	BreakerHalfOpen BreakerState = "half_open" // a single probe request decides whether to close again
+)
+
+// CircuitOpenError reports that a request was not sent because the platform's circuit breaker is open
+type CircuitOpenError struct {
+	Platform   string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s circuit breaker is open, retrying in %s", e.Platform, e.RetryAfter.Round(time.Second))
+}
+
+// Unwrap lets errors.Is match a CircuitOpenError against ErrUpstreamUnavailable
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrUpstreamUnavailable
+}
+
+// BreakerStatus describes the current state of a platform's circuit breaker
+type BreakerStatus struct {
+	Platform            string       `json:"platform"`
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	OpenedAt            *time.Time   `json:"openedAt,omitempty"`
+	RetryAt             *time.Time   `json:"retryAt,omitempty"`
+}
+
+// circuitBreaker stops sending requests to a platform after repeated failures
+type circuitBreaker struct {
+	mu       sync.Mutex
+	platform string
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool // a half-open probe request is in flight
+}
+
+// Breakers keeps a circuit breaker per platform. A breaker opens after threshold consecutive
+// failures, fails requests fast for cooldown and then lets a single probe request through.
+type Breakers struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+// NewBreakers creates a set of per-platform circuit breakers
+func NewBreakers(threshold int, cooldown time.Duration) *Breakers {
+	return &Breakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		breakers:  make(map[string]*circuitBreaker),
+	}
+}
+
+// defaultBreakers is shared by every platform service in the process
+var defaultBreakers = NewBreakers(5, 30*time.Second)
+
+// SetDefaultBreakers replaces the circuit breakers used by platform services created afterwards
+func SetDefaultBreakers(breakers *Breakers) {
+	defaultBreakers = breakers
+}
+
+// BreakerStates returns the state of every circuit breaker of the default set
+func BreakerStates() []BreakerStatus {
+	return defaultBreakers.States()
+}
+
+// States returns the state of every platform's circuit breaker
+func (b *Breakers) States() []BreakerStatus {
+	b.mu.Lock()
+	breakers := make([]*circuitBreaker, 0, len(b.breakers))
+	for _, breaker := range b.breakers {
+		breakers = append(breakers, breaker)
+	}
+	b.mu.Unlock()
+
+	states := make([]BreakerStatus, 0, len(breakers))
+	for _, breaker := range breakers {
+		states = append(states, breaker.status(b.cooldown))
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Platform < states[j].Platform
+	})
+	return states
+}
+
+// get returns the breaker of a platform, creating a closed one on first use
+func (b *Breakers) get(platform string) *circuitBreaker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	breaker, ok := b.breakers[platform]
+	if !ok {
+		breaker = &circuitBreaker{platform: platform, state: BreakerClosed}
+		b.breakers[platform] = breaker
+	}
+	return breaker
+}
+
+// allow reports whether a request may be sent, failing with a CircuitOpenError while the breaker is open.
+// Once the cooldown has passed the breaker turns half-open and lets one probe request through.
+func (c *circuitBreaker) allow(cooldown time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case BreakerOpen:
+		if wait := c.openedAt.Add(cooldown).Sub(time.Now()); wait > 0 {
+			return &CircuitOpenError{Platform: c.platform, RetryAfter: wait}
+		}
+		c.state = BreakerHalfOpen
+		c.probing = true
+	case BreakerHalfOpen:
+		if c.probing {
+			return &CircuitOpenError{Platform: c.platform, RetryAfter: time.Second}
+		}
+		c.probing = true
+	}
+	return nil
+}
+
+// success records a successful request and closes the breaker
+func (c *circuitBreaker) success() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state = BreakerClosed
+	c.failures = 0
+	c.probing = false
+}
+
+// failure records a failed request and opens the breaker after threshold consecutive failures
+// or when a half-open probe fails
+func (c *circuitBreaker) failure(threshold int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures++
+	c.probing = false
+	if c.state == BreakerHalfOpen || c.failures >= threshold {
+		c.state = BreakerOpen
+		c.openedAt = time.Now()
+	}
+}
+
+// release ends a request that says nothing about the platform's health, such as a cancelled one
+func (c *circuitBreaker) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.probing = false
+}
+
+// status returns the breaker's current state
+func (c *circuitBreaker) status(cooldown time.Duration) BreakerStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := BreakerStatus{
+		Platform:            c.platform,
+		State:               c.state,
+		ConsecutiveFailures: c.failures,
+	}
+	if c.state != BreakerClosed {
+		openedAt := c.openedAt
+		retryAt := openedAt.Add(cooldown)
+		status.OpenedAt = &openedAt
+		status.RetryAt = &retryAt
+	}
+	return status
+}
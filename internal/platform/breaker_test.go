@@ -0,0 +1,99 @@
+package platform
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	breakers := NewBreakers(3, time.Minute)
+	breaker := breakers.get("discord")
+
+	breaker.failure(breakers.threshold)
+	breaker.failure(breakers.threshold)
+	breaker.success()
+	breaker.failure(breakers.threshold)
+	breaker.failure(breakers.threshold)
+	if err := breaker.allow(breakers.cooldown); err != nil {
+		t.Fatalf("allow after 2 consecutive failures: %v", err)
+	}
+
+	breaker.failure(breakers.threshold)
+	err := breaker.allow(breakers.cooldown)
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) {
+		t.Fatalf("allow after 3 consecutive failures = %v, want a CircuitOpenError", err)
+	}
+	if openErr.RetryAfter <= 0 || openErr.RetryAfter > time.Minute {
+		t.Errorf("RetryAfter = %s, want up to the cooldown", openErr.RetryAfter)
+	}
+	if !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("CircuitOpenError does not match ErrUpstreamUnavailable")
+	}
+}
+
+func TestBreakerCooldown(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	breakers := NewBreakers(1, cooldown)
+	breaker := breakers.get("discord")
+
+	breaker.failure(breakers.threshold)
+	if err := breaker.allow(cooldown); err == nil {
+		t.Fatal("allow right after the breaker opened succeeded")
+	}
+
+	time.Sleep(cooldown)
+	if err := breaker.allow(cooldown); err != nil {
+		t.Fatalf("allow after the cooldown: %v", err)
+	}
+	if status := breaker.status(cooldown); status.State != BreakerHalfOpen {
+		t.Errorf("state after the cooldown = %s, want %s", status.State, BreakerHalfOpen)
+	}
+}
+
+func TestBreakerHalfOpenSingleProbe(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	breakers := NewBreakers(1, cooldown)
+	breaker := breakers.get("discord")
+
+	breaker.failure(breakers.threshold)
+	time.Sleep(cooldown)
+
+	if err := breaker.allow(cooldown); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if err := breaker.allow(cooldown); err == nil {
+		t.Fatal("a second request was let through while the probe is in flight")
+	}
+
+	// A failed probe opens the breaker for another cooldown
+	breaker.failure(breakers.threshold)
+	if status := breaker.status(cooldown); status.State != BreakerOpen {
+		t.Fatalf("state after a failed probe = %s, want %s", status.State, BreakerOpen)
+	}
+	if err := breaker.allow(cooldown); err == nil {
+		t.Fatal("allow right after a failed probe succeeded")
+	}
+
+	// A probe that says nothing about the platform lets the next request probe instead
+	time.Sleep(cooldown)
+	if err := breaker.allow(cooldown); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	breaker.release()
+	if err := breaker.allow(cooldown); err != nil {
+		t.Fatalf("probe after a released probe: %v", err)
+	}
+
+	// A successful probe closes the breaker
+	breaker.success()
+	for range 3 {
+		if err := breaker.allow(cooldown); err != nil {
+			t.Fatalf("allow after a successful probe: %v", err)
+		}
+	}
+	if status := breaker.status(cooldown); status.State != BreakerClosed || status.ConsecutiveFailures != 0 {
+		t.Errorf("status after a successful probe = %+v, want closed without failures", status)
+	}
+}
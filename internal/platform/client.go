@@ -0,0 +1,151 @@
+package platform
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ClientOptions tune the connections and timeouts used for platform requests
+type ClientOptions struct {
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxConnsPerHost       int
+	MaxIdleConnsPerHost   int
+	Timeout               time.Duration // overall limit for a request, including retries and rate-limit waits
+	ProxyURL              string        // proxy for every request, the environment's proxy settings when empty
+	CAFile                string        // PEM bundle trusted in addition to the system roots
+}
+
+// DefaultClientOptions are used until ConfigureClients is called
+var DefaultClientOptions = ClientOptions{
+	DialTimeout:           5 * time.Second,
+	TLSHandshakeTimeout:   5 * time.Second,
+	ResponseHeaderTimeout: 10 * time.Second,
+	IdleConnTimeout:       90 * time.Second,
+	MaxConnsPerHost:       32,
+	MaxIdleConnsPerHost:   16,
+	Timeout:               30 * time.Second,
+}
+
+var (
+	// defaultTransport carries every platform request; connections are pooled across services
+	defaultTransport http.RoundTripper = tunedTransport(DefaultClientOptions)
+
+	// defaultClientTimeout bounds every platform request made with a client from this package
+	defaultClientTimeout = DefaultClientOptions.Timeout
+)
+
+// ConfigureClients replaces the transport and timeout of clients created afterwards with ones built from opts
+func ConfigureClients(opts ClientOptions) error {
+	transport, err := NewTransport(opts)
+	if err != nil {
+		return err
+	}
+	defaultTransport = transport
+	defaultClientTimeout = opts.Timeout
+	return nil
+}
+
+// SetDefaultTransport replaces the transport that platform requests are finally sent with,
+// for example with a fake in tests. Rate limiting, retries and circuit breaking still apply on top.
+func SetDefaultTransport(transport http.RoundTripper) {
+	defaultTransport = transport
+}
+
+// NewTransport builds a pooled HTTP/2-capable transport from opts
+func NewTransport(opts ClientOptions) (*http.Transport, error) {
+	transport := tunedTransport(opts)
+
+	if opts.ProxyURL != "" {
+		proxyURL, err := url.Parse(opts.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", opts.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+
+	return transport, nil
+}
+
+// tunedTransport builds a transport from the timeouts and connection limits of opts
+func tunedTransport(opts ClientOptions) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   opts.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		MaxIdleConns:          100,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// newUpstreamTransport returns the transport requests to an upstream are sent with: retries and the
+// upstream's circuit breaker around the default rate limiter. Rate limits and breakers are tracked
+// per upstream, which is "google", "meta", "discord", "twitter" or "tiktok".
+func newUpstreamTransport(upstream string) http.RoundTripper {
+	return &retryTransport{
+		upstream: upstream,
+		policy:   defaultRetryPolicy,
+		breakers: defaultBreakers,
+		base:     defaultRateLimiter.transport(upstream),
+	}
+}
+
+// newUpstreamClient creates an HTTP client for upstream requests that are not made with a user's token
+func newUpstreamClient(upstream string) *http.Client {
+	return &http.Client{
+		Transport: newUpstreamTransport(upstream),
+		Timeout:   defaultClientTimeout,
+	}
+}
+
+// newAuthorizedClient creates an HTTP client that authorizes every request to an upstream with a token from tokenSource
+func newAuthorizedClient(upstream string, tokenSource oauth2.TokenSource) *http.Client {
+	return &http.Client{
+		Transport: &oauth2.Transport{Source: tokenSource, Base: newUpstreamTransport(upstream)},
+		Timeout:   defaultClientTimeout,
+	}
+}
+
+// getWithContext issues a GET request bound to ctx
+func getWithContext(ctx context.Context, httpClient *http.Client, reqURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	return httpClient.Do(req)
+}
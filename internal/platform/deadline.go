@@ -0,0 +1,40 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TimeoutError reports that a platform check did not finish within its deadline
+type TimeoutError struct {
+	Platform string
+	Timeout  time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s check timed out after %s", e.Platform, e.Timeout)
+}
+
+// Unwrap lets errors.Is match a TimeoutError against context.DeadlineExceeded
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// checkWithDeadline runs check against target with the platform's check timeout applied to ctx.
+// A check that runs out of time fails with a TimeoutError; a timeout of zero applies no deadline.
+func checkWithDeadline(ctx context.Context, platform string, timeout time.Duration, target string, check func(ctx context.Context, target string) (*CheckResult, error)) (*CheckResult, error) {
+	if timeout <= 0 {
+		return check(ctx, target)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result, err := check(ctx, target)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, &TimeoutError{Platform: platform, Timeout: timeout}
+	}
+	return result, err
+}
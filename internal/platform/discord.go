@@ -1,10 +1,13 @@
 package platform
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
+	"time"
 
 	"hej/internal/auth"
 	"hej/internal/config"
@@ -12,12 +15,17 @@ import (
 	"golang.org/x/oauth2"
 )
 
-// Discord OAuth endpoints
-var discordEndpoint = oauth2.Endpoint{
-	AuthURL:  "https://discord.com/api/oauth2/authorize",
-	TokenURL: "https://discord.com/api/oauth2/token",
+// discordEndpoint returns the OAuth endpoint of the configured Discord API
+func discordEndpoint(cfg *config.Config) oauth2.Endpoint {
+	return oauth2.Endpoint{
+		AuthURL:  cfg.DiscordAPIBaseURL + "/oauth2/authorize",
+		TokenURL: cfg.DiscordAPIBaseURL + "/oauth2/token",
+	}
 }
 
+// discordScopes are requested at login and needed by DiscordService
+var discordScopes = []string{"identify", "guilds", "guilds.members.read"}
+
 // DiscordAuthService handles Discord authentication
 type DiscordAuthService struct {
 	*auth.OAuthService
@@ -30,22 +38,25 @@ func NewDiscordAuthService(cfg *config.Config) *DiscordAuthService {
 		ClientID:     cfg.DiscordClientID,
 		ClientSecret: cfg.DiscordClientSecret,
 		RedirectURL:  cfg.DiscordRedirectURI,
-		Scopes:       []string{"identify", "guilds"},
-		Endpoint:     discordEndpoint,
+		Scopes:       discordScopes,
+		Endpoint:     discordEndpoint(cfg),
+	}
+	oauthService := auth.NewOAuthService("discord", oauthConfig)
+	oauthService.SetHTTPClient(newUpstreamClient("discord"))
+	if cfg.DiscordPKCE {
+		oauthService.EnablePKCE()
 	}
 	return &DiscordAuthService{
-		OAuthService: auth.NewOAuthService(oauthConfig),
+		OAuthService: oauthService,
 		cfg:          cfg,
 	}
 }
 
-// ExchangeToken exchanges an auth code for a token
-func (s *DiscordAuthService) ExchangeToken(code string) (string, error) {
-	token, err := s.ExchangeCode(code)
-	if err != nil {
-		return "", err
-	}
-	return token.AccessToken, nil
+// Revoke revokes the session's token with Discord and deletes the stored copy
+func (s *DiscordAuthService) Revoke(ctx context.Context, sessionID string) error {
+	return s.RevokeSession(ctx, sessionID, func(ctx context.Context, token *oauth2.Token) error {
+		return revokeTokenValues(ctx, "discord", s.cfg.DiscordAPIBaseURL+"/oauth2/token/revoke", s.cfg.DiscordClientID, s.cfg.DiscordClientSecret, token, nil)
+	})
 }
 
 // DiscordUser represents a Discord user profile
@@ -55,67 +66,156 @@ type DiscordUser struct {
 	Discriminator string `json:"discriminator"`
 }
 
-// DiscordGuild represents a Discord server/guild
-type DiscordGuild struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+// discordMember represents a user's member object in a guild
+type discordMember struct {
+	User         DiscordUser `json:"user"`
+	Roles        []string    `json:"roles"`
+	Nick         string      `json:"nick"`
+	JoinedAt     time.Time   `json:"joined_at"`
+	PremiumSince *time.Time  `json:"premium_since"`
+}
+
+// info converts the member object to the platform-neutral MemberInfo
+func (m *discordMember) info() *MemberInfo {
+	roles := m.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	return &MemberInfo{
+		Roles:        roles,
+		Nickname:     m.Nick,
+		JoinedAt:     m.JoinedAt,
+		PremiumSince: m.PremiumSince,
+	}
+}
+
+// DiscordAuthorization represents the current authorization returned by /oauth2/@me
+type DiscordAuthorization struct {
+	Scopes  []string    `json:"scopes"`
+	Expires time.Time   `json:"expires"`
+	User    DiscordUser `json:"user"`
 }
 
 // DiscordService represents a Discord API service
 type DiscordService struct {
-	accessToken string
+	tokenSource oauth2.TokenSource
 	httpClient  *http.Client
+	baseURL     string
 	serverID    string
+	policy      DiscordPolicy
+	timeout     time.Duration
 }
 
-// NewDiscordService creates a new Discord service with token
-func NewDiscordService(token string, cfg *config.Config) *DiscordService {
+// NewDiscordService creates a new Discord service with a token source
+func NewDiscordService(tokenSource oauth2.TokenSource, cfg *config.Config) *DiscordService {
 	return &DiscordService{
-		accessToken: token,
-		httpClient:  &http.Client{},
+		tokenSource: tokenSource,
+		httpClient:  newAuthorizedClient("discord", tokenSource),
+		baseURL:     cfg.DiscordAPIBaseURL,
 		serverID:    cfg.DiscordServerID,
+		policy:      discordPolicy(cfg),
+		timeout:     cfg.DiscordCheckTimeout,
 	}
 }
 
-// IsFollower checks if a user is a member of the specified Discord server
-func (s *DiscordService) IsFollower(_ string) (bool, error) {
+// CheckFollower checks if a user is a member of the configured Discord server within the configured check deadline
+func (s *DiscordService) CheckFollower(ctx context.Context, target string) (*CheckResult, error) {
+	return checkWithDeadline(ctx, "discord", s.timeout, target, s.checkFollower)
+}
+
+// checkFollower checks if a user is a member of the configured Discord server who meets the
+// configured role, membership age and boost policy
+func (s *DiscordService) checkFollower(ctx context.Context, _ string) (*CheckResult, error) {
 	if s.serverID == "" {
-		return false, fmt.Errorf("server ID is not configured")
+		return nil, fmt.Errorf("server ID is not configured")
+	}
+
+	member, err := s.getMember(ctx)
+	if errors.Is(err, ErrTargetNotFound) {
+		// Discord answers Unknown Guild for servers the user has not joined
+		member, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return memberResult(s.serverID, member, s.policy, "discord.users.@me.guilds.member"), nil
+}
+
+// memberResult creates the result of a membership check of serverID, where member is nil for
+// users who have not joined it
+func memberResult(serverID string, member *MemberInfo, policy DiscordPolicy, evidence string) *CheckResult {
+	if member == nil {
+		result := newCheckResult(StatusNo, ReasonNotMember, evidence)
+		result.TargetID = serverID
+		return result
 	}
 
-	// Get the user's guilds (servers)
-	guilds, err := s.getUserGuilds()
+	result := newCheckResult(StatusYes, ReasonMember, evidence)
+	if reason := policy.evaluate(member, time.Now()); reason != "" {
+		result = newCheckResult(StatusNo, reason, evidence)
+	}
+	result.TargetID = serverID
+	result.Since = &member.JoinedAt
+	result.Member = member
+	return result
+}
+
+// TokenInfo returns the user, granted scopes and expiry of the Discord token
+func (s *DiscordService) TokenInfo(ctx context.Context) (*TokenInfo, error) {
+	authorization, err := s.getAuthorization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.getUserProfile(ctx)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	// Check if the user is a member of the target server
-	for _, guild := range guilds {
-		if guild.ID == s.serverID {
-			return true, nil
-		}
+	return newTokenInfo("discord", user.ID, user.Username, authorization.Scopes, discordScopes, authorization.Expires), nil
+}
+
+// getAuthorization gets the scopes and expiry of the current authorization
+func (s *DiscordService) getAuthorization(ctx context.Context) (*DiscordAuthorization, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL+"/oauth2/@me", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, requestError("discord", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError("discord", resp, nil)
+	}
+
+	var authorization DiscordAuthorization
+	if err := json.NewDecoder(resp.Body).Decode(&authorization); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return false, nil
+	return &authorization, nil
 }
 
 // getUserProfile gets the authenticated user's Discord profile
-func (s *DiscordService) getUserProfile() (*DiscordUser, error) {
-	req, err := http.NewRequest("GET", "https://discord.com/api/users/@me", nil)
+func (s *DiscordService) getUserProfile(ctx context.Context) (*DiscordUser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL+"/users/@me", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+s.accessToken)
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("API request failed: %w", err)
+		return nil, requestError("discord", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Discord API error: %s, %s", resp.Status, string(body))
+		return nil, newAPIError("discord", resp, nil)
 	}
 
 	var user DiscordUser
@@ -126,29 +226,27 @@ func (s *DiscordService) getUserProfile() (*DiscordUser, error) {
 	return &user, nil
 }
 
-// getUserGuilds gets the servers/guilds the user is a member of
-func (s *DiscordService) getUserGuilds() ([]DiscordGuild, error) {
-	req, err := http.NewRequest("GET", "https://discord.com/api/users/@me/guilds", nil)
+// getMember gets the user's membership of the configured server, which needs the guilds.members.read scope
+func (s *DiscordService) getMember(ctx context.Context) (*MemberInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL+"/users/@me/guilds/"+url.PathEscape(s.serverID)+"/member", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+s.accessToken)
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("API request failed: %w", err)
+		return nil, requestError("discord", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Discord API error: %s, %s", resp.Status, string(body))
+		return nil, newAPIError("discord", resp, nil)
 	}
 
-	var guilds []DiscordGuild
-	if err := json.NewDecoder(resp.Body).Decode(&guilds); err != nil {
+	var member discordMember
+	if err := json.NewDecoder(resp.Body).Decode(&member); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return guilds, nil
+	return member.info(), nil
 }
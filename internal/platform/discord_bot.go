@@ -0,0 +1,303 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"hej/internal/config"
+
+	"golang.org/x/oauth2"
+)
+
+// discordMembersPageSize is the number of members a member list page holds, Discord's maximum
+const discordMembersPageSize = 1000
+
+// discordSnowflakePattern matches Discord IDs, which are numeric
+var discordSnowflakePattern = regexp.MustCompile(`^[0-9]{1,20}$`)
+
+// errUnknownMember is the Discord error for users who are not a member of a guild the bot is in,
+// which Discord tells apart from guilds the bot cannot see
+var errUnknownMember = fmt.Errorf("%w: unknown member", ErrTargetNotFound)
+
+// DiscordBotService checks membership of the configured Discord server with the app's bot token,
+// for known Discord user IDs and without the users' own tokens
+type DiscordBotService struct {
+	httpClient *http.Client
+	baseURL    string
+	serverID   string
+	policy     DiscordPolicy
+	timeout    time.Duration
+	index      *DiscordMemberIndex
+}
+
+// NewDiscordBotService creates a new Discord service that authenticates with the configured bot token
+func NewDiscordBotService(cfg *config.Config) *DiscordBotService {
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: cfg.DiscordBotToken, TokenType: "Bot"})
+	return &DiscordBotService{
+		httpClient: newAuthorizedClient("discord", tokenSource),
+		baseURL:    cfg.DiscordAPIBaseURL,
+		serverID:   cfg.DiscordServerID,
+		policy:     discordPolicy(cfg),
+		timeout:    cfg.DiscordCheckTimeout,
+		index:      defaultDiscordMembers,
+	}
+}
+
+// ForUser returns a checker of the user with the given Discord ID, for callers that work with
+// FollowerChecker
+func (s *DiscordBotService) ForUser(userID string) FollowerChecker {
+	return &discordBotChecker{service: s, userID: userID}
+}
+
+// discordBotChecker checks one user's membership with the bot token
+type discordBotChecker struct {
+	service *DiscordBotService
+	userID  string
+}
+
+func (c *discordBotChecker) CheckFollower(ctx context.Context, target string) (*CheckResult, error) {
+	return c.service.CheckPublic(ctx, c.userID, target)
+}
+
+// CheckPublic checks if the user with the given Discord ID is a member of the configured server who
+// meets the configured policy, within the configured check deadline. Members in a fresh member index
+// are checked without an API request.
+func (s *DiscordBotService) CheckPublic(ctx context.Context, userID, target string) (*CheckResult, error) {
+	return checkWithDeadline(ctx, "discord", s.timeout, target, func(ctx context.Context, _ string) (*CheckResult, error) {
+		return s.checkMember(ctx, userID)
+	})
+}
+
+// checkMember checks a user's membership, from the member index when it is fresh and holds the user
+func (s *DiscordBotService) checkMember(ctx context.Context, userID string) (*CheckResult, error) {
+	if s.serverID == "" {
+		return nil, fmt.Errorf("server ID is not configured")
+	}
+	if !discordSnowflakePattern.MatchString(userID) {
+		return nil, fmt.Errorf("%q is not a Discord user ID: %w", userID, ErrInvalidTarget)
+	}
+
+	var result *CheckResult
+	if member, ok := s.index.lookup(s.serverID, userID); ok {
+		result = memberResult(s.serverID, member, s.policy, "discord.guilds.members.index")
+	} else {
+		member, err := s.getMember(ctx, userID)
+		if errors.Is(err, errUnknownMember) {
+			member, err = nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = memberResult(s.serverID, member, s.policy, "discord.guilds.members")
+	}
+	result.UserID = userID
+	return result, nil
+}
+
+// SyncMembers reads the configured server's whole member list into the member index and returns
+// the number of members
+func (s *DiscordBotService) SyncMembers(ctx context.Context) (int, error) {
+	if s.serverID == "" {
+		return 0, fmt.Errorf("server ID is not configured")
+	}
+
+	members := make(map[string]*MemberInfo)
+	after := ""
+	for {
+		page, err := s.listMembers(ctx, after)
+		if err != nil {
+			return 0, err
+		}
+		for i := range page {
+			members[page[i].User.ID] = page[i].info()
+			after = maxSnowflake(after, page[i].User.ID)
+		}
+		if len(page) < discordMembersPageSize {
+			break
+		}
+	}
+
+	s.index.replace(s.serverID, members, time.Now())
+	return len(members), nil
+}
+
+// getMember gets a user's member object in the configured server
+func (s *DiscordBotService) getMember(ctx context.Context, userID string) (*MemberInfo, error) {
+	var member discordMember
+	reqURL := fmt.Sprintf("%s/guilds/%s/members/%s", s.baseURL, url.PathEscape(s.serverID), url.PathEscape(userID))
+	if err := s.get(withRoute(ctx, "/guilds/{guild.id}/members/{user.id}"), reqURL, &member); err != nil {
+		return nil, err
+	}
+	return member.info(), nil
+}
+
+// listMembers gets a page of the configured server's members with IDs above after, which needs the
+// Server Members privileged intent
+func (s *DiscordBotService) listMembers(ctx context.Context, after string) ([]discordMember, error) {
+	query := url.Values{"limit": {strconv.Itoa(discordMembersPageSize)}}
+	if after != "" {
+		query.Set("after", after)
+	}
+
+	var members []discordMember
+	reqURL := fmt.Sprintf("%s/guilds/%s/members?%s", s.baseURL, url.PathEscape(s.serverID), query.Encode())
+	if err := s.get(ctx, reqURL, &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// get sends a bot API request and decodes the response into v
+func (s *DiscordBotService) get(ctx context.Context, reqURL string, v any) error {
+	resp, err := getWithContext(ctx, s.httpClient, reqURL)
+	if err != nil {
+		return requestError("discord", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError("discord", resp, classifyDiscordError)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// classifyDiscordError maps the JSON error codes of the Discord API
+func classifyDiscordError(_ int, body []byte) error {
+	var response struct {
+		Code int `json:"code"`
+	}
+	if json.Unmarshal(body, &response) == nil && response.Code == 10007 {
+		return errUnknownMember
+	}
+	return nil
+}
+
+// maxSnowflake returns the larger of two Discord IDs, which order by value
+func maxSnowflake(a, b string) string {
+	if len(a) != len(b) {
+		if len(a) > len(b) {
+			return a
+		}
+		return b
+	}
+	return max(a, b)
+}
+
+// DiscordMemberIndex is a local copy of a Discord server's member list, so membership checks do not
+// spend the API rate limit
+type DiscordMemberIndex struct {
+	mu       sync.RWMutex
+	serverID string
+	members  map[string]*MemberInfo
+	syncedAt time.Time
+	maxAge   time.Duration // age at which the copy is too stale to answer checks, never when zero
+}
+
+// DiscordMemberIndexStatus describes the member index
+type DiscordMemberIndexStatus struct {
+	ServerID string    `json:"serverId"`
+	Members  int       `json:"members"`
+	SyncedAt time.Time `json:"syncedAt"`
+	Fresh    bool      `json:"fresh"`
+}
+
+// defaultDiscordMembers is shared by every bot service in the process
+var defaultDiscordMembers = &DiscordMemberIndex{}
+
+// lookup returns a user's member object from a fresh copy of the server's member list. ok is false
+// for users the copy does not hold, who may have joined since it was read, and when there is no
+// fresh copy.
+func (x *DiscordMemberIndex) lookup(serverID, userID string) (*MemberInfo, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if !x.fresh(serverID, time.Now()) {
+		return nil, false
+	}
+	member, ok := x.members[userID]
+	return member, ok
+}
+
+// fresh reports whether the index holds a current copy of the server's member list; callers hold mu
+func (x *DiscordMemberIndex) fresh(serverID string, now time.Time) bool {
+	if x.members == nil || x.serverID != serverID {
+		return false
+	}
+	return x.maxAge <= 0 || now.Sub(x.syncedAt) < x.maxAge
+}
+
+// replace swaps in a newly read member list
+func (x *DiscordMemberIndex) replace(serverID string, members map[string]*MemberInfo, syncedAt time.Time) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.serverID = serverID
+	x.members = members
+	x.syncedAt = syncedAt
+}
+
+// status describes the index
+func (x *DiscordMemberIndex) status() *DiscordMemberIndexStatus {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if x.members == nil {
+		return nil
+	}
+	return &DiscordMemberIndexStatus{
+		ServerID: x.serverID,
+		Members:  len(x.members),
+		SyncedAt: x.syncedAt,
+		Fresh:    x.fresh(x.serverID, time.Now()),
+	}
+}
+
+// DiscordMemberIndexState describes the process-wide member index, or returns nil before the first sync
+func DiscordMemberIndexState() *DiscordMemberIndexStatus {
+	return defaultDiscordMembers.status()
+}
+
+// StartDiscordMemberSync syncs the configured server's member list into the member index right away
+// and then every configured interval until ctx is done. The index stops answering checks when a sync
+// is missed, which sends them back to the API.
+func StartDiscordMemberSync(ctx context.Context, cfg *config.Config) {
+	service := NewDiscordBotService(cfg)
+	interval := cfg.DiscordMemberSyncInterval
+
+	service.index.mu.Lock()
+	service.index.maxAge = 2 * interval
+	service.index.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			started := time.Now()
+			if n, err := service.SyncMembers(ctx); err != nil {
+				log.Printf("Discord member sync failed: %v", err)
+			} else {
+				log.Printf("Discord member sync read %d members in %s", n, time.Since(started).Round(time.Millisecond))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,67 @@
+package platform
+
+import (
+	"slices"
+	"time"
+
+	"hej/internal/config"
+)
+
+// RoleMatch selects whether a Discord member needs any or all of the required roles
+type RoleMatch string
+
+// Role match modes
+const (
+	RoleMatchAny RoleMatch = "any"
+	RoleMatchAll RoleMatch = "all"
+)
+
+// DiscordPolicy lists what a member of the configured Discord server must meet to pass a check.
+// The zero policy accepts every member.
+type DiscordPolicy struct {
+	Roles        []string  // role IDs, of which the member needs any or all depending on RoleMatch
+	RoleMatch    RoleMatch // RoleMatchAny when unset
+	MinAge       time.Duration
+	RequireBoost bool // the member must be boosting the server
+}
+
+// discordPolicy returns the member policy configured on the server
+func discordPolicy(cfg *config.Config) DiscordPolicy {
+	return DiscordPolicy{
+		Roles:        cfg.DiscordRequiredRoles,
+		RoleMatch:    RoleMatch(cfg.DiscordRoleMatch),
+		MinAge:       cfg.DiscordMinMemberAge,
+		RequireBoost: cfg.DiscordRequireBoost,
+	}
+}
+
+// evaluate returns the reason member fails the policy for, or an empty string when it passes
+func (p DiscordPolicy) evaluate(member *MemberInfo, now time.Time) string {
+	if !p.hasRoles(member.Roles) {
+		return ReasonMissingRoles
+	}
+	if p.MinAge > 0 && now.Sub(member.JoinedAt) < p.MinAge {
+		return ReasonMembershipTooNew
+	}
+	if p.RequireBoost && member.PremiumSince == nil {
+		return ReasonNotBoosting
+	}
+	return ""
+}
+
+// hasRoles reports whether roles satisfy the policy's required roles
+func (p DiscordPolicy) hasRoles(roles []string) bool {
+	if len(p.Roles) == 0 {
+		return true
+	}
+	for _, required := range p.Roles {
+		has := slices.Contains(roles, required)
+		if p.RoleMatch == RoleMatchAll && !has {
+			return false
+		}
+		if p.RoleMatch != RoleMatchAll && has {
+			return true
+		}
+	}
+	return p.RoleMatch == RoleMatchAll
+}
@@ -0,0 +1,165 @@
+package platform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Platform check errors; handlers map each of them to its own HTTP status
+var (
+	ErrTokenInvalid        = errors.New("platform token is invalid or expired")
+	ErrMissingScope        = errors.New("platform token is missing a required scope")
+	ErrTargetNotFound      = errors.New("target was not found")
+	ErrInvalidTarget       = errors.New("target is not valid for the platform")
+	ErrRateLimited         = errors.New("rate limited by the platform")
+	ErrUpstreamUnavailable = errors.New("platform is unavailable")
+	ErrFollowingPrivate    = errors.New("following list is private")
+)
+
+// APIError is an unsuccessful response from a platform API.
+// The response body is logged server-side and never included in the error.
+type APIError struct {
+	Platform   string
+	StatusCode int
+	Kind       error         // the platform check error the response maps to, nil when it is not recognised
+	RetryAfter time.Duration // how long a rate-limited response asks the client to wait
+}
+
+func (e *APIError) Error() string {
+	if e.Kind != nil {
+		return fmt.Sprintf("%s API error: %d, %v", e.Platform, e.StatusCode, e.Kind)
+	}
+	return fmt.Sprintf("%s API error: %d %s", e.Platform, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Unwrap lets errors.Is match an APIError against the platform check error it maps to
+func (e *APIError) Unwrap() error {
+	return e.Kind
+}
+
+// classifyFunc maps a platform-specific error response to a platform check error.
+// It returns nil to fall back to classifying by status code.
+type classifyFunc func(status int, body []byte) error
+
+// newAPIError reads an unsuccessful response, logs its body and classifies it
+func newAPIError(platform string, resp *http.Response, classify classifyFunc) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	log.Printf("%s API error: %s, %s", platform, resp.Status, body)
+
+	var kind error
+	if classify != nil {
+		kind = classify(resp.StatusCode, body)
+	}
+	if kind == nil {
+		kind = statusError(resp.StatusCode)
+	}
+	apiErr := &APIError{Platform: platform, StatusCode: resp.StatusCode, Kind: kind}
+	if kind == ErrRateLimited {
+		apiErr.RetryAfter = retryAfter(resp.Header, time.Now())
+	}
+	return apiErr
+}
+
+// RetryAfter returns how long to wait before retrying a check that failed with err,
+// or zero when err does not say
+func RetryAfter(err error) time.Duration {
+	var limitErr *RateLimitError
+	if errors.As(err, &limitErr) {
+		return limitErr.RetryAfter
+	}
+	var openErr *CircuitOpenError
+	if errors.As(err, &openErr) {
+		return openErr.RetryAfter
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.RetryAfter
+	}
+	return 0
+}
+
+// statusError maps an HTTP status code to a platform check error
+func statusError(status int) error {
+	switch {
+	case status == http.StatusUnauthorized:
+		return ErrTokenInvalid
+	case status == http.StatusForbidden:
+		return ErrMissingScope
+	case status == http.StatusNotFound:
+		return ErrTargetNotFound
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status >= http.StatusInternalServerError:
+		return ErrUpstreamUnavailable
+	}
+	return nil
+}
+
+// requestError wraps an error from sending a request to a platform API.
+// Failed requests count as the platform being unavailable; the cause stays matchable with errors.Is.
+func requestError(platform string, err error) error {
+	return fmt.Errorf("%s API request failed: %w: %w", platform, ErrUpstreamUnavailable, err)
+}
+
+// classifyGoogleError maps the error reasons of Google APIs
+func classifyGoogleError(_ int, body []byte) error {
+	var response struct {
+		Error struct {
+			Errors []struct {
+				Reason string `json:"reason"`
+			} `json:"errors"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &response) != nil {
+		return nil
+	}
+
+	for _, e := range response.Error.Errors {
+		switch e.Reason {
+		case "authError":
+			return ErrTokenInvalid
+		case "insufficientPermissions", "forbidden":
+			return ErrMissingScope
+		case "subscriptionForbidden":
+			return ErrFollowingPrivate
+		case "channelNotFound", "subscriberNotFound":
+			return ErrTargetNotFound
+		case "rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded":
+			return ErrRateLimited
+		case "backendError":
+			return ErrUpstreamUnavailable
+		}
+	}
+	return nil
+}
+
+// classifyMetaError maps the error codes of the Graph API, which reports most errors as 400
+func classifyMetaError(_ int, body []byte) error {
+	var response struct {
+		Error struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &response) != nil {
+		return nil
+	}
+
+	switch code := response.Error.Code; {
+	case code == 102 || code == 190:
+		return ErrTokenInvalid
+	case code == 10 || (code >= 200 && code <= 299):
+		return ErrMissingScope
+	case code == 803:
+		return ErrTargetNotFound
+	case code == 4 || code == 17 || code == 32 || code == 613:
+		return ErrRateLimited
+	case code == 1 || code == 2:
+		return ErrUpstreamUnavailable
+	}
+	return nil
+}
@@ -1,18 +1,25 @@
 package platform
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
 
 	"hej/internal/auth"
 	"hej/internal/config"
 
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/facebook"
 )
 
+// facebookScopes are requested at login and needed by FacebookService
+var facebookScopes = []string{"public_profile", "user_likes"}
+
 // FacebookAuthService handles Facebook authentication
 type FacebookAuthService struct {
 	*auth.OAuthService
@@ -25,22 +32,22 @@ func NewFacebookAuthService(cfg *config.Config) *FacebookAuthService {
 		ClientID:     cfg.MetaAppID,
 		ClientSecret: cfg.MetaAppSecret,
 		RedirectURL:  cfg.MetaRedirectURI,
-		Scopes:       []string{"public_profile"},
-		Endpoint:     facebook.Endpoint,
+		Scopes:       facebookScopes,
+		Endpoint:     metaEndpoint(cfg),
 	}
+	oauthService := auth.NewOAuthService("facebook", oauthConfig)
+	oauthService.SetHTTPClient(newUpstreamClient("meta"))
 	return &FacebookAuthService{
-		OAuthService: auth.NewOAuthService(oauthConfig),
+		OAuthService: oauthService,
 		cfg:          cfg,
 	}
 }
 
-// ExchangeToken exchanges an auth code for a token
-func (s *FacebookAuthService) ExchangeToken(code string) (string, error) {
-	token, err := s.ExchangeCode(code)
-	if err != nil {
-		return "", err
-	}
-	return token.AccessToken, nil
+// Revoke removes the app's permissions for the session's user and deletes the stored token
+func (s *FacebookAuthService) Revoke(ctx context.Context, sessionID string) error {
+	return s.RevokeSession(ctx, sessionID, func(ctx context.Context, token *oauth2.Token) error {
+		return revokeMetaPermissions(ctx, s.cfg.MetaGraphBaseURL, token)
+	})
 }
 
 // FacebookUser represents a Facebook user profile
@@ -49,95 +56,236 @@ type FacebookUser struct {
 	Name string `json:"name"`
 }
 
-// FacebookFollowingResponse represents the response from the Facebook following API
-type FacebookFollowingResponse struct {
-	Data []FacebookUser `json:"data"`
+// FacebookLikesResponse represents the response from the Facebook likes API
+type FacebookLikesResponse struct {
+	Data []struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		CreatedTime string `json:"created_time"`
+	} `json:"data"`
 }
 
+// facebookPermissionsResponse represents the permissions a user granted or declined to the app
+type facebookPermissionsResponse struct {
+	Data []struct {
+		Permission string `json:"permission"`
+		Status     string `json:"status"`
+	} `json:"data"`
+}
+
+var (
+	facebookPageIDPattern = regexp.MustCompile(`^[0-9]+$`)
+	facebookVanityPattern = regexp.MustCompile(`^[A-Za-z0-9.-]+$`)
+)
+
 // FacebookService represents a Facebook API service
 type FacebookService struct {
-	accessToken string
+	tokenSource oauth2.TokenSource
 	httpClient  *http.Client
+	baseURL     string
+	appID       string
+	appSecret   string
+	timeout     time.Duration
 }
 
-// NewFacebookService creates a new Facebook service with token
-func NewFacebookService(token string, _ *config.Config) *FacebookService {
+// NewFacebookService creates a new Facebook service with a token source
+func NewFacebookService(tokenSource oauth2.TokenSource, cfg *config.Config) *FacebookService {
 	return &FacebookService{
-		accessToken: token,
-		httpClient:  &http.Client{},
+		tokenSource: tokenSource,
+		httpClient:  newAuthorizedClient("meta", tokenSource),
+		baseURL:     cfg.MetaGraphBaseURL,
+		appID:       cfg.MetaAppID,
+		appSecret:   cfg.MetaAppSecret,
+		timeout:     cfg.FacebookCheckTimeout,
 	}
 }
 
-// IsFollower checks if a user follows a page or profile
-func (s *FacebookService) IsFollower(targetUserID string) (bool, error) {
-	if targetUserID == "" {
-		return false, fmt.Errorf("targetUserID is required")
+// CheckFollower checks if a user likes a Page within the configured check deadline
+func (s *FacebookService) CheckFollower(ctx context.Context, target string) (*CheckResult, error) {
+	return checkWithDeadline(ctx, "facebook", s.timeout, target, s.checkFollower)
+}
+
+// checkFollower checks if a user likes a Page, given as a Page ID, vanity name or URL. A Page is
+// looked up directly in the user's likes; when it is not there, the user's permissions tell a Page
+// the user does not like apart from likes the app may not read.
+func (s *FacebookService) checkFollower(ctx context.Context, target string) (*CheckResult, error) {
+	if target == "" {
+		return nil, fmt.Errorf("target page is required")
 	}
 
-	// Get the current user's profile
-	me, err := s.getProfile()
+	pageID, err := s.resolvePage(ctx, target)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	// Check if the user follows the target
-	isFollowing, err := s.checkFollowing(me.ID, targetUserID)
+	likes, err := s.getLike(ctx, pageID)
+	if errors.Is(err, ErrMissingScope) {
+		result := newCheckResult(StatusIndeterminate, ReasonPermissionDeclined, "facebook.likes")
+		result.TargetID = pageID
+		return result, nil
+	}
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	if len(likes.Data) == 0 {
+		granted, err := s.hasPermission(ctx, "user_likes")
+		if err != nil {
+			return nil, err
+		}
+		if !granted {
+			result := newCheckResult(StatusIndeterminate, ReasonPermissionDeclined, "facebook.permissions")
+			result.TargetID = pageID
+			return result, nil
+		}
 	}
 
-	return isFollowing, nil
+	result := boolResult(len(likes.Data) > 0, ReasonFollowing, ReasonNotFollowing, "facebook.likes")
+	result.TargetID = pageID
+	if len(likes.Data) > 0 {
+		if since, err := time.Parse(metaTimeLayout, likes.Data[0].CreatedTime); err == nil {
+			result.Since = &since
+		}
+	}
+	return result, nil
 }
 
-// getProfile gets the current user's profile
-func (s *FacebookService) getProfile() (*FacebookUser, error) {
-	reqURL := fmt.Sprintf("https://graph.facebook.com/v18.0/me?access_token=%s", s.accessToken)
+// TokenInfo returns the user, granted permissions and expiry of the Facebook token
+func (s *FacebookService) TokenInfo(ctx context.Context) (*TokenInfo, error) {
+	token, err := s.tokenSource.Token()
+	if err != nil {
+		return nil, err
+	}
 
-	resp, err := s.httpClient.Get(reqURL)
+	debug, err := debugMetaToken(ctx, s.baseURL, token.AccessToken, s.appID, s.appSecret)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get profile: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: %s, %s", resp.Status, string(body))
+	me, err := s.getProfile(ctx)
+	if err != nil {
+		return nil, err
 	}
 
+	return newTokenInfo("facebook", debug.UserID, me.Name, debug.Scopes, facebookScopes, debug.Expiry()), nil
+}
+
+// getProfile gets the current user's profile
+func (s *FacebookService) getProfile(ctx context.Context) (*FacebookUser, error) {
 	var user FacebookUser
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := s.get(ctx, s.baseURL+"/me", &user); err != nil {
+		return nil, err
 	}
-
 	return &user, nil
 }
 
-// checkFollowing checks if a user follows another user
-func (s *FacebookService) checkFollowing(userID, targetPageID string) (bool, error) {
-	reqURL := fmt.Sprintf("https://graph.facebook.com/v18.0/%s/subscribedto?access_token=%s", userID, s.accessToken)
-
-	resp, err := s.httpClient.Get(reqURL)
+// resolvePage returns the ID of a Page given as a Page ID, vanity name or facebook.com URL
+func (s *FacebookService) resolvePage(ctx context.Context, target string) (string, error) {
+	ref, err := parsePageRef(target)
 	if err != nil {
-		return false, fmt.Errorf("failed to check following: %w", err)
+		return "", err
+	}
+	if facebookPageIDPattern.MatchString(ref) {
+		return ref, nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return false, fmt.Errorf("API error: %s, %s", resp.Status, string(body))
+	var page FacebookUser
+	if err := s.get(withRoute(ctx, "/{page-id}"), fmt.Sprintf("%s/%s?fields=id,name", s.baseURL, url.PathEscape(ref)), &page); err != nil {
+		return "", err
 	}
+	return page.ID, nil
+}
 
-	var response FacebookFollowingResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return false, fmt.Errorf("failed to decode response: %w", err)
+// parsePageRef returns the Page ID or vanity name a target refers to
+func parsePageRef(target string) (string, error) {
+	target = strings.TrimSpace(target)
+	// A bare facebook.com looks like a vanity name but is a URL without a Page
+	if facebookPageIDPattern.MatchString(target) || (facebookVanityPattern.MatchString(target) && !isFacebookHost(target)) {
+		return target, nil
 	}
 
-	// Check if the target user is in the list of friends
-	for _, user := range response.Data {
-		if user.ID == targetPageID {
-			return true, nil
-		}
+	invalid := fmt.Errorf("%q is not a Facebook Page ID, vanity name or URL: %w", target, ErrInvalidTarget)
+
+	raw := target
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || !isFacebookHost(u.Hostname()) {
+		return "", invalid
+	}
+
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	var ref string
+	switch {
+	case len(segments) == 0:
+		// facebook.com/ names no Page
+		return "", invalid
+	case len(segments) == 1 && segments[0] == "profile.php":
+		// facebook.com/profile.php?id=ID
+		ref = u.Query().Get("id")
+	case len(segments) >= 3 && (segments[0] == "pages" || segments[0] == "people"):
+		// facebook.com/pages/Name/ID
+		ref = segments[2]
+	case len(segments) >= 2 && segments[0] == "pg":
+		// facebook.com/pg/vanity/about
+		ref = segments[1]
+	case len(segments) >= 1:
+		ref = segments[0]
+	}
+	if !facebookPageIDPattern.MatchString(ref) && !facebookVanityPattern.MatchString(ref) {
+		return "", invalid
+	}
+	return ref, nil
+}
+
+// isFacebookHost reports whether host is one of Facebook's web hosts
+func isFacebookHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, prefix := range []string{"www.", "m.", "web.", "business."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	return host == "facebook.com" || host == "fb.com"
+}
+
+// getLike looks a Page up in the user's likes; the data is empty when the user does not like it
+func (s *FacebookService) getLike(ctx context.Context, pageID string) (*FacebookLikesResponse, error) {
+	var response FacebookLikesResponse
+	if err := s.get(withRoute(ctx, "/me/likes/{page-id}"), fmt.Sprintf("%s/me/likes/%s?fields=id,name,created_time", s.baseURL, pageID), &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// hasPermission reports whether the user granted the app a permission
+func (s *FacebookService) hasPermission(ctx context.Context, permission string) (bool, error) {
+	var response facebookPermissionsResponse
+	if err := s.get(ctx, s.baseURL+"/me/permissions", &response); err != nil {
+		return false, err
 	}
 
+	for _, p := range response.Data {
+		if p.Permission == permission {
+			return p.Status == "granted", nil
+		}
+	}
 	return false, nil
 }
+
+// get sends a Graph API request and decodes the response into v
+func (s *FacebookService) get(ctx context.Context, reqURL string, v any) error {
+	resp, err := getWithContext(ctx, s.httpClient, reqURL)
+	if err != nil {
+		return requestError("facebook", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError("facebook", resp, classifyMetaError)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package platform
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePageRef(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string // empty when the target is invalid
+	}{
+		{"20531316728", "20531316728"},
+		{"  20531316728  ", "20531316728"},
+		{"cocacola", "cocacola"},
+		{"coca.cola-official", "coca.cola-official"},
+		{"https://www.facebook.com/cocacola", "cocacola"},
+		{"facebook.com/cocacola/", "cocacola"},
+		{"https://m.facebook.com/cocacola/about?ref=page", "cocacola"},
+		{"https://fb.com/20531316728", "20531316728"},
+		{"https://www.facebook.com/profile.php?id=100064", "100064"},
+		{"https://www.facebook.com/pages/Coca-Cola/20531316728", "20531316728"},
+		{"https://www.facebook.com/pg/cocacola/about", "cocacola"},
+
+		{"", ""},
+		{"facebook.com", ""},
+		{"www.facebook.com", ""},
+		{"fb.com", ""},
+		{"facebook.com/", ""},
+		{"https://facebook.com", ""},
+		{"https://facebook.com/", ""},
+		{"https://www.facebook.com/profile.php", ""},
+		{"https://example.com/cocacola", ""},
+		{"coca cola", ""},
+	}
+	for _, tt := range tests {
+		ref, err := parsePageRef(tt.target)
+		if tt.want == "" {
+			if !errors.Is(err, ErrInvalidTarget) {
+				t.Errorf("parsePageRef(%q) = %q, %v, want ErrInvalidTarget", tt.target, ref, err)
+			}
+			continue
+		}
+		if err != nil || ref != tt.want {
+			t.Errorf("parsePageRef(%q) = %q, %v, want %q", tt.target, ref, err, tt.want)
+		}
+	}
+}
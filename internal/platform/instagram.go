@@ -1,18 +1,30 @@
 package platform
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
 
 	"hej/internal/auth"
 	"hej/internal/config"
 
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/facebook" // Instagram uses the same OAuth endpoint as Facebook
 )
 
+// instagramScopes are requested at login and needed by InstagramService. The Instagram Graph API
+// reaches a professional account through the Facebook Page it is linked to.
+var instagramScopes = []string{"instagram_basic", "pages_show_list", "pages_read_engagement"}
+
+// errNoProfessionalAccount is returned for users whose Facebook Pages link no Instagram professional
+// account, the only kind the Graph API serves
+var errNoProfessionalAccount = errors.New("no Instagram professional account is linked to the user's Facebook Pages")
+
 // InstagramAuthService handles Instagram authentication
 type InstagramAuthService struct {
 	*auth.OAuthService
@@ -24,163 +36,250 @@ func NewInstagramAuthService(cfg *config.Config) *InstagramAuthService {
 	oauthConfig := &oauth2.Config{
 		ClientID:     cfg.MetaAppID,
 		ClientSecret: cfg.MetaAppSecret,
-		RedirectURL:  cfg.MetaRedirectURI,
-		Scopes:       []string{"user_profile", "instagram_basic"},
-		Endpoint:     facebook.Endpoint,
+		RedirectURL:  cfg.InstagramRedirectURI,
+		Scopes:       instagramScopes,
+		Endpoint:     metaEndpoint(cfg),
 	}
+	oauthService := auth.NewOAuthService("instagram", oauthConfig)
+	oauthService.SetHTTPClient(newUpstreamClient("meta"))
 	return &InstagramAuthService{
-		OAuthService: auth.NewOAuthService(oauthConfig),
+		OAuthService: oauthService,
 		cfg:          cfg,
 	}
 }
 
-// ExchangeToken exchanges an auth code for a token
-func (s *InstagramAuthService) ExchangeToken(code string) (string, error) {
-	token, err := s.ExchangeCode(code)
-	if err != nil {
-		return "", err
-	}
-	return token.AccessToken, nil
+// Revoke removes the app's permissions for the session's user and deletes the stored token
+func (s *InstagramAuthService) Revoke(ctx context.Context, sessionID string) error {
+	return s.RevokeSession(ctx, sessionID, func(ctx context.Context, token *oauth2.Token) error {
+		return revokeMetaPermissions(ctx, s.cfg.MetaGraphBaseURL, token)
+	})
 }
 
-// InstagramProfile represents an Instagram user profile
-type InstagramProfile struct {
+// InstagramAccount represents an Instagram professional account
+type InstagramAccount struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
 }
 
-// InstagramFollowerResponse represents the response from the Instagram followers API
-type InstagramFollowerResponse struct {
+// instagramPagesResponse represents the Facebook Pages of a user with their linked Instagram accounts
+type instagramPagesResponse struct {
 	Data []struct {
-		ID string `json:"id"`
+		ID                       string            `json:"id"`
+		InstagramBusinessAccount *InstagramAccount `json:"instagram_business_account"`
 	} `json:"data"`
+}
+
+// InstagramMedia represents a post of an Instagram account
+type InstagramMedia struct {
+	ID        string `json:"id"`
+	Caption   string `json:"caption"`
+	Permalink string `json:"permalink"`
+	Timestamp string `json:"timestamp"`
+}
+
+// InstagramMediaResponse represents a page of an account's posts
+type InstagramMediaResponse struct {
+	Data   []InstagramMedia `json:"data"`
 	Paging struct {
 		Next string `json:"next"`
 	} `json:"paging"`
 }
 
+// instagramUsernamePattern matches valid Instagram usernames
+var instagramUsernamePattern = regexp.MustCompile(`^[A-Za-z0-9._]{1,30}$`)
+
 // InstagramService represents an Instagram API service
 type InstagramService struct {
-	accessToken string
+	tokenSource oauth2.TokenSource
 	httpClient  *http.Client
+	baseURL     string
+	appID       string
+	appSecret   string
+	timeout     time.Duration
+	pages       PageLimits
 }
 
-// NewInstagramService creates a new Instagram service with token
-func NewInstagramService(token string, _ *config.Config) *InstagramService {
+// NewInstagramService creates a new Instagram service with a token source
+func NewInstagramService(tokenSource oauth2.TokenSource, cfg *config.Config) *InstagramService {
 	return &InstagramService{
-		accessToken: token,
-		httpClient:  &http.Client{},
+		tokenSource: tokenSource,
+		httpClient:  newAuthorizedClient("meta", tokenSource),
+		baseURL:     cfg.MetaGraphBaseURL,
+		appID:       cfg.MetaAppID,
+		appSecret:   cfg.MetaAppSecret,
+		timeout:     cfg.InstagramCheckTimeout,
+		pages:       pageLimits(cfg),
 	}
 }
 
-// IsFollower checks if a user follows another Instagram user
-func (s *InstagramService) IsFollower(targetUsername string) (bool, error) {
+// CheckFollower checks if a user engages with another Instagram account within the configured check deadline
+func (s *InstagramService) CheckFollower(ctx context.Context, target string) (*CheckResult, error) {
+	return checkWithDeadline(ctx, "instagram", s.timeout, target, s.checkFollower)
+}
+
+// checkFollower checks if the user's Instagram account mentions the target account in its posts.
+// The Instagram Graph API does not expose who an account follows, nor comments on another account's
+// media, so a mention by the user is the relationship signal it can verify.
+func (s *InstagramService) checkFollower(ctx context.Context, targetUsername string) (*CheckResult, error) {
+	targetUsername = strings.TrimPrefix(targetUsername, "@")
 	if targetUsername == "" {
-		return false, fmt.Errorf("targetUsername is required")
+		return nil, fmt.Errorf("target username is required")
+	}
+	if !instagramUsernamePattern.MatchString(targetUsername) {
+		return nil, fmt.Errorf("%q is not an Instagram username: %w", targetUsername, ErrInvalidTarget)
 	}
 
-	// First, get the user's Instagram profile ID
-	profile, err := s.getProfile()
+	// First, get the professional account linked to the user's Facebook Pages. Users with only a
+	// personal account cannot be checked, which is not an error in the request.
+	account, err := s.getAccount(ctx)
+	if errors.Is(err, errNoProfessionalAccount) {
+		return newCheckResult(StatusIndeterminate, ReasonUnsupported, "instagram.accounts"), nil
+	}
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	// Then check if the target user is in the followers list
-	targetProfile, err := s.getUserByUsername(targetUsername)
+	// Then look the target up; only professional accounts can be discovered
+	target, err := s.discoverAccount(ctx, account.ID, targetUsername)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	isFollowing, err := s.checkFollowing(profile.ID, targetProfile.ID)
+	var mention *InstagramMedia
+	scan, err := s.checkMentions(ctx, account.ID, target.Username, &mention)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	return isFollowing, nil
+	result := scanResult(scan, ReasonMentioned, ReasonNotMentioned, "instagram.media")
+	result.UserID = account.ID
+	result.TargetID = target.ID
+	if mention != nil {
+		if since, err := time.Parse(metaTimeLayout, mention.Timestamp); err == nil {
+			result.Since = &since
+		}
+	}
+	return result, nil
 }
 
-// getProfile gets the authenticated user's Instagram profile
-func (s *InstagramService) getProfile() (*InstagramProfile, error) {
-	// Get the Instagram user ID from the Facebook Graph API
-	reqURL := fmt.Sprintf("https://graph.facebook.com/v18.0/me?fields=id,name&access_token=%s", s.accessToken)
-
-	resp, err := s.httpClient.Get(reqURL)
+// TokenInfo returns the account, granted permissions and expiry of the Instagram token
+func (s *InstagramService) TokenInfo(ctx context.Context) (*TokenInfo, error) {
+	token, err := s.tokenSource.Token()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get profile: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: %s, %s", resp.Status, string(body))
+	debug, err := debugMetaToken(ctx, s.baseURL, token.AccessToken, s.appID, s.appSecret)
+	if err != nil {
+		return nil, err
 	}
 
-	var profile InstagramProfile
-	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	account, err := s.getAccount(ctx)
+	if errors.Is(err, errNoProfessionalAccount) {
+		account, err = &InstagramAccount{}, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return &profile, nil
+	return newTokenInfo("instagram", account.ID, account.Username, debug.Scopes, instagramScopes, debug.Expiry()), nil
 }
 
-// getUserByUsername gets a user profile by username
-func (s *InstagramService) getUserByUsername(username string) (*InstagramProfile, error) {
-	// Note: This is a simplified implementation and might need adjustment based on Instagram's API
-	reqURL := fmt.Sprintf("https://graph.facebook.com/v18.0/instagram_oembed?url=https://www.instagram.com/%s/&access_token=%s", username, s.accessToken)
+// getAccount gets the Instagram professional account linked to one of the user's Facebook Pages
+func (s *InstagramService) getAccount(ctx context.Context) (*InstagramAccount, error) {
+	query := url.Values{"fields": {"instagram_business_account{id,username}"}, "limit": {"100"}}
 
-	resp, err := s.httpClient.Get(reqURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user by username: %w", err)
+	var response instagramPagesResponse
+	if err := s.get(ctx, s.baseURL+"/me/accounts?"+query.Encode(), &response); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: %s, %s", resp.Status, string(body))
+	for _, page := range response.Data {
+		if page.InstagramBusinessAccount != nil {
+			return page.InstagramBusinessAccount, nil
+		}
 	}
+	return nil, errNoProfessionalAccount
+}
+
+// discoverAccount looks another professional account up by username through business discovery
+func (s *InstagramService) discoverAccount(ctx context.Context, accountID, username string) (*InstagramAccount, error) {
+	query := url.Values{"fields": {"business_discovery.username(" + username + "){id,username}"}}
 
-	var data struct {
-		AuthorName string `json:"author_name"`
-		AuthorID   string `json:"author_id"`
+	var response struct {
+		BusinessDiscovery *InstagramAccount `json:"business_discovery"`
+	}
+	if err := s.get(withRoute(ctx, "/{ig-user-id}"), fmt.Sprintf("%s/%s?%s", s.baseURL, accountID, query.Encode()), &response); err != nil {
+		return nil, err
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if response.BusinessDiscovery == nil {
+		return nil, ErrTargetNotFound
 	}
+	return response.BusinessDiscovery, nil
+}
 
-	return &InstagramProfile{
-		ID:       data.AuthorID,
-		Username: data.AuthorName,
-	}, nil
+// checkMentions scans an account's posts, newest first, for a caption that mentions username and
+// stores the first such post in mention
+func (s *InstagramService) checkMentions(ctx context.Context, accountID, username string, mention **InstagramMedia) (pageScan, error) {
+	pattern := mentionPattern(username)
+	return scanPages(ctx, s.pages, func(ctx context.Context, cursor string) (bool, string, error) {
+		reqURL := cursor
+		if reqURL == "" {
+			query := url.Values{"fields": {"id,caption,permalink,timestamp"}, "limit": {"50"}}
+			reqURL = fmt.Sprintf("%s/%s/media?%s", s.baseURL, accountID, query.Encode())
+		}
+
+		var page InstagramMediaResponse
+		if err := s.get(withRoute(ctx, "/{ig-user-id}/media"), reqURL, &page); err != nil {
+			return false, "", err
+		}
+
+		for i := range page.Data {
+			if pattern.MatchString(page.Data[i].Caption) {
+				*mention = &page.Data[i]
+				return true, "", nil
+			}
+		}
+		next, err := metaNextPage(s.baseURL, page.Paging.Next)
+		return false, next, err
+	})
 }
 
-// checkFollowing checks if a user follows another user
-func (s *InstagramService) checkFollowing(userID, targetUserID string) (bool, error) {
-	// Instagram API to check followers
-	reqURL := fmt.Sprintf("https://graph.facebook.com/v18.0/%s/following?access_token=%s", userID, s.accessToken)
+// mentionPattern matches an @mention of username, which must not run on into a longer username
+func mentionPattern(username string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(?:^|[^\w.@])@` + regexp.QuoteMeta(username) + `(?:$|[^\w.]|\.(?:$|[^\w]))`)
+}
 
-	resp, err := s.httpClient.Get(reqURL)
+// get sends a Graph API request and decodes the response into v
+func (s *InstagramService) get(ctx context.Context, reqURL string, v any) error {
+	resp, err := getWithContext(ctx, s.httpClient, reqURL)
 	if err != nil {
-		return false, fmt.Errorf("failed to check following: %w", err)
+		return requestError("instagram", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return false, fmt.Errorf("API error: %s, %s", resp.Status, string(body))
+		return newAPIError("instagram", resp, classifyInstagramError)
 	}
 
-	var response InstagramFollowerResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return false, fmt.Errorf("failed to decode response: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
 	}
+	return nil
+}
 
-	// Check if target user ID is in the list
-	for _, user := range response.Data {
-		if user.ID == targetUserID {
-			return true, nil
-		}
+// classifyInstagramError maps Instagram Graph API errors, where business discovery reports
+// usernames that do not belong to a professional account as an invalid user
+func classifyInstagramError(status int, body []byte) error {
+	var response struct {
+		Error struct {
+			Code    int `json:"code"`
+			Subcode int `json:"error_subcode"`
+		} `json:"error"`
 	}
-
-	return false, nil
+	if json.Unmarshal(body, &response) == nil && (response.Error.Code == 110 || response.Error.Subcode == 2207013) {
+		return ErrTargetNotFound
+	}
+	return classifyMetaError(status, body)
 }
@@ -0,0 +1,82 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"hej/internal/config"
+
+	"golang.org/x/oauth2"
+)
+
+// metaTimeLayout is how the Graph API formats timestamps
+const metaTimeLayout = "2006-01-02T15:04:05-0700"
+
+// metaTokenDebug is the data returned by the Graph API debug_token endpoint
+type metaTokenDebug struct {
+	AppID     string   `json:"app_id"`
+	UserID    string   `json:"user_id"`
+	IsValid   bool     `json:"is_valid"`
+	ExpiresAt int64    `json:"expires_at"`
+	Scopes    []string `json:"scopes"`
+}
+
+// Expiry returns when the token expires, or the zero time if it never does
+func (d *metaTokenDebug) Expiry() time.Time {
+	if d.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(d.ExpiresAt, 0)
+}
+
+// debugMetaToken inspects a user access token with the app's credentials
+func debugMetaToken(ctx context.Context, graphBaseURL, accessToken, appID, appSecret string) (*metaTokenDebug, error) {
+	query := url.Values{
+		"input_token":  {accessToken},
+		"access_token": {appID + "|" + appSecret},
+	}
+	reqURL := graphBaseURL + "/debug_token?" + query.Encode()
+
+	// The app token in the query authenticates this call, so the user's token must not be sent as well
+	resp, err := getWithContext(ctx, newUpstreamClient("meta"), reqURL)
+	if err != nil {
+		return nil, requestError("meta", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError("meta", resp, classifyMetaError)
+	}
+
+	var response struct {
+		Data metaTokenDebug `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &response.Data, nil
+}
+
+// metaNextPage checks the paging.next link of a Graph list before it is followed, so the user's
+// token is only ever sent to the configured Graph API
+func metaNextPage(graphBaseURL, next string) (string, error) {
+	if next != "" && !strings.HasPrefix(next, graphBaseURL+"/") {
+		return "", fmt.Errorf("unexpected Graph API paging link %q", next)
+	}
+	return next, nil
+}
+
+// metaEndpoint returns the OAuth endpoint of the configured Meta login dialog and Graph API
+func metaEndpoint(cfg *config.Config) oauth2.Endpoint {
+	return oauth2.Endpoint{
+		AuthURL:   cfg.MetaAuthBaseURL + "/dialog/oauth",
+		TokenURL:  cfg.MetaGraphBaseURL + "/oauth/access_token",
+		AuthStyle: oauth2.AuthStyleInParams,
+	}
+}
@@ -0,0 +1,88 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"hej/internal/config"
+)
+
+// PageLimits bounds how much of a paginated list a single check reads
+type PageLimits struct {
+	MaxPages int           // pages read at most, unlimited when zero
+	Budget   time.Duration // time spent paging at most, unlimited when zero
+}
+
+// pageLimits returns the configured page limits
+func pageLimits(cfg *config.Config) PageLimits {
+	return PageLimits{MaxPages: cfg.PaginationMaxPages, Budget: cfg.PaginationBudget}
+}
+
+// pageFunc fetches the page at cursor, which is empty for the first page. It reports whether the
+// target is on the page and returns the cursor of the next page, or an empty cursor on the last page.
+type pageFunc func(ctx context.Context, cursor string) (found bool, next string, err error)
+
+// pageScan is the outcome of walking a paginated list
+type pageScan struct {
+	Found    bool // the target was found
+	Complete bool // the list was read to the end, so a target that was not found is not on it
+	Pages    int  // pages read
+}
+
+// scanPages walks a cursor-paginated list until the target is found, the list ends or a limit
+// runs out. Running out of pages or time is not an error: the scan is returned incomplete, as it
+// is when the platform hands out a cursor it already returned, which would only loop.
+func scanPages(ctx context.Context, limits PageLimits, fetch pageFunc) (pageScan, error) {
+	pageCtx := ctx
+	if limits.Budget > 0 {
+		var cancel context.CancelFunc
+		pageCtx, cancel = context.WithTimeout(ctx, limits.Budget)
+		defer cancel()
+	}
+
+	var scan pageScan
+	cursor := ""
+	seen := make(map[string]bool)
+	for {
+		if limits.MaxPages > 0 && scan.Pages >= limits.MaxPages {
+			return scan, nil
+		}
+		if pageCtx.Err() != nil && ctx.Err() == nil {
+			return scan, nil
+		}
+
+		found, next, err := fetch(pageCtx, cursor)
+		if err != nil {
+			// A page cut off by the budget leaves the scan incomplete, unlike the check's own deadline
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return scan, nil
+			}
+			return scan, err
+		}
+		scan.Pages++
+
+		if found {
+			scan.Found = true
+			return scan, nil
+		}
+		if next == "" {
+			scan.Complete = true
+			return scan, nil
+		}
+		if seen[next] {
+			return scan, nil
+		}
+		seen[next] = true
+		cursor = next
+	}
+}
+
+// scanResult creates the result of a scan: yes when the target was found, no when the whole list
+// was read, and indeterminate when a page limit ran out first
+func scanResult(scan pageScan, yesReason, noReason, evidence string) *CheckResult {
+	if !scan.Found && !scan.Complete {
+		return newCheckResult(StatusIndeterminate, ReasonListIncomplete, evidence)
+	}
+	return boolResult(scan.Found, yesReason, noReason, evidence)
+}
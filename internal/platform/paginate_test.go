@@ -0,0 +1,141 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// listPages serves a list of pages numbered from 0, with the target on page target (none when
+// negative); the cursor of a page is its number, and the first page has an empty cursor
+func listPages(pages, target int, fetched *[]string) pageFunc {
+	return func(ctx context.Context, cursor string) (bool, string, error) {
+		*fetched = append(*fetched, cursor)
+		page := 0
+		if cursor != "" {
+			page, _ = strconv.Atoi(cursor)
+		}
+		next := ""
+		if page+1 < pages {
+			next = strconv.Itoa(page + 1)
+		}
+		return page == target, next, nil
+	}
+}
+
+func TestScanPages(t *testing.T) {
+	tests := []struct {
+		name     string
+		pages    int
+		target   int
+		limits   PageLimits
+		want     pageScan
+		wantEval CheckStatus
+	}{
+		{"found on the first page", 3, 0, PageLimits{}, pageScan{Found: true, Pages: 1}, StatusYes},
+		{"found on a later page", 5, 3, PageLimits{}, pageScan{Found: true, Pages: 4}, StatusYes},
+		{"read to the end", 4, -1, PageLimits{}, pageScan{Complete: true, Pages: 4}, StatusNo},
+		{"single empty page", 1, -1, PageLimits{}, pageScan{Complete: true, Pages: 1}, StatusNo},
+		{"page limit before the target", 5, 3, PageLimits{MaxPages: 2}, pageScan{Pages: 2}, StatusIndeterminate},
+		{"page limit on the target's page", 5, 1, PageLimits{MaxPages: 2}, pageScan{Found: true, Pages: 2}, StatusYes},
+		{"page limit on the last page", 2, -1, PageLimits{MaxPages: 2}, pageScan{Complete: true, Pages: 2}, StatusNo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetched []string
+			scan, err := scanPages(context.Background(), tt.limits, listPages(tt.pages, tt.target, &fetched))
+			if err != nil {
+				t.Fatalf("scanPages: %v", err)
+			}
+			if scan != tt.want {
+				t.Errorf("scanPages = %+v, want %+v", scan, tt.want)
+			}
+			if len(fetched) != scan.Pages {
+				t.Errorf("fetched %d pages but counted %d", len(fetched), scan.Pages)
+			}
+			if result := scanResult(scan, ReasonFollowing, ReasonNotFollowing, "test"); result.Status != tt.wantEval {
+				t.Errorf("scanResult status = %s, want %s", result.Status, tt.wantEval)
+			}
+		})
+	}
+}
+
+func TestScanPagesStopsOnRepeatedCursor(t *testing.T) {
+	tests := map[string][]string{
+		"same cursor again": {"a", "a"},
+		"cycle":             {"a", "b", "c", "a"},
+	}
+	for name, cursors := range tests {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			scan, err := scanPages(context.Background(), PageLimits{MaxPages: 100}, func(ctx context.Context, cursor string) (bool, string, error) {
+				next := cursors[calls]
+				calls++
+				return false, next, nil
+			})
+			if err != nil {
+				t.Fatalf("scanPages: %v", err)
+			}
+			if scan.Complete || scan.Found || scan.Pages != len(cursors) {
+				t.Errorf("scanPages = %+v, want an incomplete scan of %d pages", scan, len(cursors))
+			}
+		})
+	}
+}
+
+// slowPages serves an endless list whose pages take delay each and honour ctx
+func slowPages(delay time.Duration, pages *int) pageFunc {
+	return func(ctx context.Context, cursor string) (bool, string, error) {
+		select {
+		case <-ctx.Done():
+			return false, "", ctx.Err()
+		case <-time.After(delay):
+		}
+		*pages++
+		return false, strconv.Itoa(*pages), nil
+	}
+}
+
+func TestScanPagesBudgetRunsOutMidScan(t *testing.T) {
+	var pages int
+	scan, err := scanPages(context.Background(), PageLimits{Budget: 50 * time.Millisecond}, slowPages(20*time.Millisecond, &pages))
+	if err != nil {
+		t.Fatalf("scanPages: %v", err)
+	}
+	if scan.Complete || scan.Found || scan.Pages == 0 || scan.Pages != pages {
+		t.Errorf("scanPages = %+v after %d pages, want an incomplete scan of the pages read", scan, pages)
+	}
+	if result := scanResult(scan, ReasonFollowing, ReasonNotFollowing, "test"); result.Reason != ReasonListIncomplete {
+		t.Errorf("scanResult reason = %s, want %s", result.Reason, ReasonListIncomplete)
+	}
+}
+
+func TestScanPagesCheckDeadlineIsAnError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var pages int
+	_, err := scanPages(ctx, PageLimits{Budget: time.Minute}, slowPages(20*time.Millisecond, &pages))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("scanPages past the check's deadline = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestScanPagesReturnsFetchErrors(t *testing.T) {
+	calls := 0
+	scan, err := scanPages(context.Background(), PageLimits{}, func(ctx context.Context, cursor string) (bool, string, error) {
+		calls++
+		if calls == 2 {
+			return false, "", ErrRateLimited
+		}
+		return false, "next", nil
+	})
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("scanPages = %v, want the page's error", err)
+	}
+	if scan.Pages != 1 {
+		t.Errorf("scanPages counted %d pages, want 1", scan.Pages)
+	}
+}
@@ -1,16 +1,44 @@
 package platform
 
+import (
+	"context"
+
+	"hej/internal/auth"
+
+	"golang.org/x/oauth2"
+)
+
 // FollowerChecker defines the interface for checking if a user follows another user
 type FollowerChecker interface {
-	// IsFollower checks if a user with the given username follows the authenticated user
-	IsFollower(username string) (bool, error)
+	// CheckFollower checks if the authenticated user follows the target
+	CheckFollower(ctx context.Context, target string) (*CheckResult, error)
+}
+
+// PublicChecker checks public data of a user who identifies themselves instead of logging in
+type PublicChecker interface {
+	// CheckPublic checks if the user with the given platform ID or handle follows the target
+	CheckPublic(ctx context.Context, user, target string) (*CheckResult, error)
 }
 
 // AuthService defines common authentication methods
 type AuthService interface {
-	// GetAuthURL returns the OAuth URL for authentication
-	GetAuthURL() string
+	// GetAuthURL returns the OAuth URL for authentication and the state it was issued with
+	GetAuthURL(opts auth.LoginOptions) (string, string)
+
+	// ParseState verifies the signature of a returned state and returns the login options it carries
+	ParseState(state string) (*auth.LoginOptions, error)
+
+	// ExchangeToken validates the returned state, exchanges an authorization code for a token
+	// and returns an opaque session ID referring to the stored token
+	ExchangeToken(ctx context.Context, code, state string) (string, error)
+
+	// TokenSource returns a token source for a session's token, refreshing it when it expires
+	TokenSource(ctx context.Context, sessionID string) (oauth2.TokenSource, error)
+
+	// EndSession deletes a session and its stored token
+	EndSession(sessionID string) error
 
-	// ExchangeToken exchanges an authorization code for an access token
-	ExchangeToken(code string) (string, error)
+	// Revoke revokes a session's token with the platform and deletes the stored token.
+	// Revoking an unknown or already revoked session succeeds.
+	Revoke(ctx context.Context, sessionID string) error
 }
@@ -0,0 +1,467 @@
+package platform
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitMode selects what happens to a request whose rate-limit budget is exhausted
+type RateLimitMode string
+
+const (
+	RateLimitWait RateLimitMode = "wait" // wait for the budget to reset, up to the maximum wait
+	RateLimitFail RateLimitMode = "fail" // fail immediately
+)
+
+// Rate-limit scopes
+const (
+	RateLimitScopeToken = "token" // the limit applies to a single user's token
+	RateLimitScopeApp   = "app"   // the limit applies to the whole app
+)
+
+// budgetPruneInterval is how often budgets that have reset are dropped from the tracked budgets
+const budgetPruneInterval = time.Minute
+
+// Graph reports app usage as a percentage of a rolling one hour window without a reset time,
+// so an exhausted app budget is held for this long before another request probes it again
+const appUsageCooldown = time.Minute
+
+// RateLimitBudget is the remaining budget of one upstream rate limit
+type RateLimitBudget struct {
+	Platform  string    `json:"platform"`
+	Scope     string    `json:"scope"`
+	Token     string    `json:"token,omitempty"` // short hash of the token, for token scoped limits
+	Bucket    string    `json:"bucket"`
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+
+	reserve int // requests are held back once Remaining drops to this value
+}
+
+// exhausted reports whether the budget blocks requests at now
+func (b *RateLimitBudget) exhausted(now time.Time) bool {
+	return b.Remaining <= b.reserve && now.Before(b.Reset)
+}
+
+// RateLimitError reports that a request was not sent because its rate-limit budget is exhausted
+type RateLimitError struct {
+	Platform   string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s rate limit budget exhausted, resets in %s", e.Platform, e.RetryAfter.Round(time.Second))
+}
+
+// Unwrap lets errors.Is match a RateLimitError against ErrRateLimited
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// budgetKey identifies a tracked budget
+type budgetKey struct {
+	platform string
+	token    string // empty for app scoped budgets
+	bucket   string
+}
+
+// RateLimiter tracks the rate-limit budgets platforms report in their response headers,
+// per token and per app, and holds back requests that would exceed them
+type RateLimiter struct {
+	mode              RateLimitMode
+	maxWait           time.Duration
+	appUsageThreshold int
+	base              http.RoundTripper
+
+	mu           sync.Mutex
+	budgets      map[budgetKey]*RateLimitBudget
+	routeBuckets map[string]string // Discord's bucket of each route, once a response has named it
+	prunedAt     time.Time
+}
+
+// NewRateLimiter creates a rate limiter sending requests with base, or the default transport when base is nil.
+// Requests wait at most maxWait for an exhausted budget in wait mode; Graph requests are held back
+// once the app has used appUsageThreshold percent of its quota.
+func NewRateLimiter(mode RateLimitMode, maxWait time.Duration, appUsageThreshold int, base http.RoundTripper) *RateLimiter {
+	return &RateLimiter{
+		mode:              mode,
+		maxWait:           maxWait,
+		appUsageThreshold: appUsageThreshold,
+		base:              base,
+		budgets:           make(map[budgetKey]*RateLimitBudget),
+		routeBuckets:      make(map[string]string),
+	}
+}
+
+// defaultRateLimiter is shared by every platform service in the process
+var defaultRateLimiter = NewRateLimiter(RateLimitWait, 2*time.Second, 90, nil)
+
+// SetDefaultRateLimiter replaces the rate limiter used by platform services created afterwards
+func SetDefaultRateLimiter(limiter *RateLimiter) {
+	defaultRateLimiter = limiter
+}
+
+// RateLimitBudgets returns the budgets currently tracked by the default rate limiter
+func RateLimitBudgets() []RateLimitBudget {
+	return defaultRateLimiter.Budgets()
+}
+
+// routeKey is the context key of a request's route template
+type routeKey struct{}
+
+// withRoute tags the requests made with ctx with the route template of their endpoint, such as
+// /2/users/by/username/{username}, so requests about different users or pages spend the same
+// budget. Requests without a template are tracked by their path.
+func withRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+// requestRoute returns the method and route template of a request
+func requestRoute(req *http.Request) string {
+	if route, ok := req.Context().Value(routeKey{}).(string); ok {
+		return req.Method + " " + route
+	}
+	return req.Method + " " + req.URL.Path
+}
+
+// rateLimitedTransport sends an upstream's requests through a rate limiter
+type rateLimitedTransport struct {
+	limiter  *RateLimiter
+	upstream string
+}
+
+// RoundTrip sends a request through the limiter
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.limiter.roundTrip(t.upstream, req)
+}
+
+// transport returns a transport that sends an upstream's requests through the limiter
+func (l *RateLimiter) transport(upstream string) http.RoundTripper {
+	return &rateLimitedTransport{limiter: l, upstream: upstream}
+}
+
+// roundTrip sends a request once its budgets allow it and records the budgets reported in the response
+func (l *RateLimiter) roundTrip(platform string, req *http.Request) (*http.Response, error) {
+	token := tokenKey(req)
+	route := requestRoute(req)
+	if err := l.acquire(req.Context(), platform, token, l.bucket(platform, route)); err != nil {
+		return nil, err
+	}
+
+	resp, err := l.baseTransport().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	l.record(platform, token, route, resp)
+	return resp, nil
+}
+
+// bucket returns the budget a route spends: the Discord bucket it belongs to once known, since
+// Discord shares buckets between routes, and otherwise the route itself
+func (l *RateLimiter) bucket(platform, route string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if bucket, ok := l.routeBuckets[platform+" "+route]; ok {
+		return bucket
+	}
+	return route
+}
+
+// baseTransport returns the transport requests are finally sent with
+func (l *RateLimiter) baseTransport() http.RoundTripper {
+	if l.base != nil {
+		return l.base
+	}
+	return defaultTransport
+}
+
+// Budgets returns a snapshot of the tracked budgets that have not reset yet
+func (l *RateLimiter) Budgets() []RateLimitBudget {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+	budgets := make([]RateLimitBudget, 0, len(l.budgets))
+	for _, budget := range l.budgets {
+		budgets = append(budgets, *budget)
+	}
+	sort.Slice(budgets, func(i, j int) bool {
+		a, b := budgets[i], budgets[j]
+		if a.Platform != b.Platform {
+			return a.Platform < b.Platform
+		}
+		if a.Token != b.Token {
+			return a.Token < b.Token
+		}
+		return a.Bucket < b.Bucket
+	})
+	return budgets
+}
+
+// acquire takes one request from the budgets that apply to a request, waiting for them to reset
+// or failing with a RateLimitError when one is exhausted
+func (l *RateLimiter) acquire(ctx context.Context, platform, token, bucket string) error {
+	for {
+		wait := l.reserve(platform, token, bucket)
+		if wait <= 0 {
+			return nil
+		}
+		if l.mode == RateLimitFail || wait > l.maxWait {
+			return &RateLimitError{Platform: platform, RetryAfter: wait}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes one request from the applicable budgets if none of them is exhausted.
+// Otherwise it returns how long until the last exhausted budget resets.
+func (l *RateLimiter) reserve(platform, token, bucket string) time.Duration {
+	keys := []budgetKey{
+		{platform: platform, token: token, bucket: bucket},
+		{platform: platform, bucket: RateLimitScopeApp},
+	}
+	if token != "" {
+		keys = append(keys, budgetKey{platform: platform, token: token, bucket: "global"})
+	}
+
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var wait time.Duration
+	for _, key := range keys {
+		if budget, ok := l.budgets[key]; ok && budget.exhausted(now) {
+			wait = max(wait, budget.Reset.Sub(now))
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	// Count the request against request-based budgets so a burst cannot overrun them before the response arrives
+	for _, key := range keys {
+		if budget, ok := l.budgets[key]; ok && key.bucket != RateLimitScopeApp && now.Before(budget.Reset) {
+			budget.Remaining--
+		}
+	}
+	return 0
+}
+
+// record updates the budgets from the rate-limit headers of a response to a request to route
+func (l *RateLimiter) record(platform, token, route string, resp *http.Response) {
+	now := time.Now()
+	var budgets []*RateLimitBudget
+
+	switch platform {
+	case "twitter":
+		budgets = append(budgets, parseTwitterRateLimit(resp.Header))
+	case "discord":
+		budgets = append(budgets, parseDiscordRateLimit(resp.Header, now))
+	case "meta":
+		budgets = append(budgets, parseMetaAppUsage(resp.Header, now, l.appUsageThreshold))
+	}
+
+	// A 429 without usable headers still blocks the endpoint for as long as the platform asks
+	if resp.StatusCode == http.StatusTooManyRequests && !anyBudget(budgets) {
+		budgets = append(budgets, &RateLimitBudget{
+			Scope: RateLimitScopeToken,
+			Reset: now.Add(retryAfter(resp.Header, now)),
+		})
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Budgets are per token, so those that have reset are dropped now and then to keep the map bounded
+	if now.Sub(l.prunedAt) >= budgetPruneInterval {
+		l.prune(now)
+		l.prunedAt = now
+	}
+	for _, budget := range budgets {
+		if budget == nil {
+			continue
+		}
+		budget.Platform = platform
+		key := budgetKey{platform: platform, bucket: route}
+		switch {
+		case budget.Scope == RateLimitScopeApp:
+			key.bucket = RateLimitScopeApp
+		case budget.Bucket == "global":
+			key.token = token
+			key.bucket = "global"
+		case budget.Bucket != "":
+			// Discord names the bucket, which later requests to the route are counted against
+			key.token = token
+			key.bucket = budget.Bucket
+			l.routeBuckets[platform+" "+route] = budget.Bucket
+		default:
+			key.token = token
+		}
+		if budget.Bucket == "" {
+			budget.Bucket = key.bucket
+		}
+		if key.token != "" {
+			budget.Token = shortHash(key.token)
+		}
+		l.budgets[key] = budget
+	}
+}
+
+// prune removes the budgets that have reset; callers hold mu
+func (l *RateLimiter) prune(now time.Time) {
+	for key, budget := range l.budgets {
+		if now.After(budget.Reset) {
+			delete(l.budgets, key)
+		}
+	}
+}
+
+// anyBudget reports whether any budget was parsed
+func anyBudget(budgets []*RateLimitBudget) bool {
+	for _, budget := range budgets {
+		if budget != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTwitterRateLimit parses Twitter's per-endpoint x-rate-limit-* headers
+func parseTwitterRateLimit(header http.Header) *RateLimitBudget {
+	remaining, err := strconv.Atoi(header.Get("X-Rate-Limit-Remaining"))
+	if err != nil {
+		return nil
+	}
+	limit, _ := strconv.Atoi(header.Get("X-Rate-Limit-Limit"))
+	reset, err := strconv.ParseInt(header.Get("X-Rate-Limit-Reset"), 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	return &RateLimitBudget{
+		Scope:     RateLimitScopeToken,
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     time.Unix(reset, 0),
+	}
+}
+
+// parseDiscordRateLimit parses Discord's X-RateLimit-* bucket headers.
+// A 429 for the global limit blocks every request made with the token.
+func parseDiscordRateLimit(header http.Header, now time.Time) *RateLimitBudget {
+	if header.Get("X-RateLimit-Global") == "true" {
+		return &RateLimitBudget{
+			Scope:  RateLimitScopeToken,
+			Bucket: "global",
+			Reset:  now.Add(retryAfter(header, now)),
+		}
+	}
+
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return nil
+	}
+	limit, _ := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	resetAfter, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64)
+	if err != nil {
+		return nil
+	}
+
+	return &RateLimitBudget{
+		Scope:     RateLimitScopeToken,
+		Bucket:    header.Get("X-RateLimit-Bucket"),
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     now.Add(seconds(resetAfter)),
+	}
+}
+
+// parseMetaAppUsage parses Graph's X-App-Usage header, which reports the percentage of the app's
+// hourly quota used by call count, total time and CPU time
+func parseMetaAppUsage(header http.Header, now time.Time, threshold int) *RateLimitBudget {
+	value := header.Get("X-App-Usage")
+	if value == "" {
+		return nil
+	}
+
+	var usage struct {
+		CallCount    int `json:"call_count"`
+		TotalTime    int `json:"total_time"`
+		TotalCPUTime int `json:"total_cputime"`
+	}
+	if err := json.Unmarshal([]byte(value), &usage); err != nil {
+		return nil
+	}
+
+	used := max(usage.CallCount, usage.TotalTime, usage.TotalCPUTime)
+	return &RateLimitBudget{
+		Scope:     RateLimitScopeApp,
+		Limit:     100,
+		Remaining: max(100-used, 0),
+		Reset:     now.Add(appUsageCooldown),
+		reserve:   100 - threshold,
+	}
+}
+
+// retryAfter returns how long a rate-limited response asks the client to wait.
+// It understands Retry-After in seconds, Discord's X-RateLimit-Reset-After and Twitter's
+// x-rate-limit-reset, and falls back to one second.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	if value, err := strconv.ParseFloat(header.Get("Retry-After"), 64); err == nil {
+		return seconds(value)
+	}
+	if value, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64); err == nil {
+		return seconds(value)
+	}
+	if value, err := strconv.ParseInt(header.Get("X-Rate-Limit-Reset"), 10, 64); err == nil {
+		if wait := time.Unix(value, 0).Sub(now); wait > 0 {
+			return wait
+		}
+	}
+	return time.Second
+}
+
+// seconds converts a number of seconds to a duration, rounding up to whole milliseconds
+func seconds(value float64) time.Duration {
+	return time.Duration(math.Ceil(value*1000)) * time.Millisecond
+}
+
+// tokenKey identifies the token a request is authorized with without keeping the token itself
+func tokenKey(req *http.Request) string {
+	authorization := req.Header.Get("Authorization")
+	if authorization == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(authorization))
+	return hex.EncodeToString(sum[:])
+}
+
+// shortHash shortens a token key for display
+func shortHash(key string) string {
+	if len(key) > 12 {
+		return key[:12]
+	}
+	return key
+}
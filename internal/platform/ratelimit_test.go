@@ -0,0 +1,210 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// fakeUpstream answers every request with the headers and status of the last call to respond, and
+// counts the requests that reach it
+type fakeUpstream struct {
+	status   int
+	header   http.Header
+	requests int
+}
+
+func (u *fakeUpstream) respond(status int, header map[string]string) {
+	u.status = status
+	u.header = make(http.Header)
+	for name, value := range header {
+		u.header.Set(name, value)
+	}
+}
+
+func (u *fakeUpstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	u.requests++
+	status := u.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &http.Response{StatusCode: status, Header: u.header.Clone(), Body: http.NoBody, Request: req}, nil
+}
+
+// send sends a request with a user's token through the limiter, tagged with route unless it is empty
+func send(t *testing.T, limiter *RateLimiter, platform, route, path string) error {
+	t.Helper()
+	ctx := context.Background()
+	if route != "" {
+		ctx = withRoute(ctx, route)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.example.com"+path, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer user-token")
+
+	resp, err := limiter.transport(platform).RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func TestRateLimiterWaitsForExhaustedBudget(t *testing.T) {
+	upstream := &fakeUpstream{}
+	limiter := NewRateLimiter(RateLimitWait, time.Second, 90, upstream)
+
+	upstream.respond(http.StatusOK, map[string]string{
+		"X-RateLimit-Bucket":      "members",
+		"X-RateLimit-Limit":       "5",
+		"X-RateLimit-Remaining":   "0",
+		"X-RateLimit-Reset-After": "0.2",
+	})
+	if err := send(t, limiter, "discord", "", "/users/@me"); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+
+	started := time.Now()
+	if err := send(t, limiter, "discord", "", "/users/@me"); err != nil {
+		t.Fatalf("second request: %v", err)
+	}
+	if waited := time.Since(started); waited < 150*time.Millisecond {
+		t.Errorf("second request was sent after %s, want it held until the budget reset", waited)
+	}
+	if upstream.requests != 2 {
+		t.Errorf("upstream got %d requests, want 2", upstream.requests)
+	}
+}
+
+func TestRateLimiterWaitGivesUpBeyondMaxWait(t *testing.T) {
+	upstream := &fakeUpstream{}
+	limiter := NewRateLimiter(RateLimitWait, 100*time.Millisecond, 90, upstream)
+
+	upstream.respond(http.StatusTooManyRequests, map[string]string{"Retry-After": "30"})
+	send(t, limiter, "twitter", "", "/2/users/me")
+
+	err := send(t, limiter, "twitter", "", "/2/users/me")
+	var limitErr *RateLimitError
+	if !errors.As(err, &limitErr) || limitErr.RetryAfter <= 29*time.Second {
+		t.Fatalf("request with budget resetting in 30s = %v, want a RateLimitError", err)
+	}
+	if upstream.requests != 1 {
+		t.Errorf("upstream got %d requests, want 1", upstream.requests)
+	}
+}
+
+func TestRateLimiterFailMode(t *testing.T) {
+	upstream := &fakeUpstream{}
+	limiter := NewRateLimiter(RateLimitFail, time.Minute, 90, upstream)
+
+	reset := time.Now().Add(time.Minute).Unix()
+	upstream.respond(http.StatusOK, map[string]string{
+		"X-Rate-Limit-Limit":     "15",
+		"X-Rate-Limit-Remaining": "0",
+		"X-Rate-Limit-Reset":     strconv.FormatInt(reset, 10),
+	})
+	if err := send(t, limiter, "twitter", "", "/2/users/me"); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+
+	err := send(t, limiter, "twitter", "", "/2/users/me")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("request with an exhausted budget = %v, want ErrRateLimited", err)
+	}
+	if wait := RetryAfter(err); wait <= 0 || wait > time.Minute {
+		t.Errorf("RetryAfter = %s, want up to a minute", wait)
+	}
+	if upstream.requests != 1 {
+		t.Errorf("upstream got %d requests, want 1", upstream.requests)
+	}
+
+	// Other endpoints have budgets of their own
+	if err := send(t, limiter, "twitter", "", "/2/users/42/following"); err != nil {
+		t.Errorf("request to another endpoint: %v", err)
+	}
+}
+
+func TestRateLimiterGraphAppUsage(t *testing.T) {
+	upstream := &fakeUpstream{}
+	limiter := NewRateLimiter(RateLimitFail, time.Minute, 90, upstream)
+
+	upstream.respond(http.StatusOK, map[string]string{"X-App-Usage": `{"call_count":50,"total_time":20,"total_cputime":10}`})
+	if err := send(t, limiter, "meta", "", "/me"); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	if err := send(t, limiter, "meta", "", "/me/accounts"); err != nil {
+		t.Fatalf("request at 50%% usage: %v", err)
+	}
+
+	upstream.respond(http.StatusOK, map[string]string{"X-App-Usage": `{"call_count":40,"total_time":92,"total_cputime":10}`})
+	if err := send(t, limiter, "meta", "", "/me/accounts"); err != nil {
+		t.Fatalf("request reporting 92%% usage: %v", err)
+	}
+
+	// The app budget holds back every Graph request, whatever its endpoint or token
+	if err := send(t, limiter, "meta", "", "/me/likes/123"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("request above the usage threshold = %v, want ErrRateLimited", err)
+	}
+
+	budgets := limiter.Budgets()
+	if len(budgets) != 1 || budgets[0].Scope != RateLimitScopeApp || budgets[0].Remaining != 8 {
+		t.Errorf("Budgets = %+v, want one app budget with 8 remaining", budgets)
+	}
+}
+
+func TestRateLimiterSharesBudgetsAcrossPaths(t *testing.T) {
+	upstream := &fakeUpstream{}
+	limiter := NewRateLimiter(RateLimitFail, time.Minute, 90, upstream)
+
+	// A 429 looking up one username holds back lookups of every username
+	const route = "/2/users/by/username/{username}"
+	upstream.respond(http.StatusTooManyRequests, map[string]string{"Retry-After": "60"})
+	send(t, limiter, "twitter", route, "/2/users/by/username/bob")
+
+	upstream.respond(http.StatusOK, nil)
+	for _, username := range []string{"alice", "carol"} {
+		if err := send(t, limiter, "twitter", route, "/2/users/by/username/"+username); !errors.Is(err, ErrRateLimited) {
+			t.Errorf("lookup of %s = %v, want ErrRateLimited", username, err)
+		}
+	}
+	if err := send(t, limiter, "twitter", "", "/2/users/me"); err != nil {
+		t.Errorf("request to another endpoint: %v", err)
+	}
+	if len(limiter.Budgets()) != 1 {
+		t.Errorf("Budgets = %+v, want one budget for the route", limiter.Budgets())
+	}
+
+	// Discord routes that name the same bucket spend the same budget
+	upstream.respond(http.StatusOK, map[string]string{
+		"X-RateLimit-Bucket":      "shared",
+		"X-RateLimit-Limit":       "5",
+		"X-RateLimit-Remaining":   "4",
+		"X-RateLimit-Reset-After": "60",
+	})
+	if err := send(t, limiter, "discord", "/guilds/{guild.id}/members/{user.id}", "/guilds/1/members/2"); err != nil {
+		t.Fatalf("member request: %v", err)
+	}
+	upstream.respond(http.StatusOK, map[string]string{
+		"X-RateLimit-Bucket":      "shared",
+		"X-RateLimit-Limit":       "5",
+		"X-RateLimit-Remaining":   "0",
+		"X-RateLimit-Reset-After": "60",
+	})
+	if err := send(t, limiter, "discord", "", "/guilds/1/members"); err != nil {
+		t.Fatalf("member list request: %v", err)
+	}
+	if err := send(t, limiter, "discord", "/guilds/{guild.id}/members/{user.id}", "/guilds/1/members/3"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("member request in an exhausted bucket = %v, want ErrRateLimited", err)
+	}
+}
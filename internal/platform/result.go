@@ -0,0 +1,78 @@
+package platform
+
+import "time"
+
+// CheckStatus is the outcome of a check
+type CheckStatus string
+
+// Check statuses
+const (
+	StatusYes           CheckStatus = "yes"
+	StatusNo            CheckStatus = "no"
+	StatusIndeterminate CheckStatus = "indeterminate"
+)
+
+// Reason codes explaining a check result
+const (
+	ReasonFollowing          = "following"
+	ReasonNotFollowing       = "not_following"
+	ReasonSubscribed         = "subscribed"
+	ReasonNotSubscribed      = "not_subscribed"
+	ReasonMember             = "member"
+	ReasonNotMember          = "not_member"
+	ReasonMissingRoles       = "missing_roles"      // the member lacks the roles the server requires
+	ReasonMembershipTooNew   = "membership_too_new" // the member joined more recently than the server requires
+	ReasonNotBoosting        = "not_boosting"       // the member does not boost the server
+	ReasonMentioned          = "mentioned"          // the user mentioned the target in their own posts
+	ReasonNotMentioned       = "not_mentioned"      // none of the user's posts mention the target
+	ReasonFollowingPrivate   = "following_private"
+	ReasonPermissionDeclined = "permission_declined" // the user declined the permission the check needs
+	ReasonUnsupported        = "unsupported"
+	ReasonListIncomplete     = "list_incomplete" // a page or time limit ran out before the whole list was read
+)
+
+// CheckResult is the outcome of a follow, subscription or membership check
+type CheckResult struct {
+	Status CheckStatus `json:"status"`
+	Reason string      `json:"reason"`
+
+	// Platform IDs resolved for the authenticated user and the target, when the check resolved them
+	UserID   string `json:"userId,omitempty"`
+	TargetID string `json:"targetId,omitempty"`
+
+	// Since is when the user followed, subscribed or joined, if the platform provides it
+	Since     *time.Time `json:"since,omitempty"`
+	CheckedAt time.Time  `json:"checkedAt"`
+
+	// Evidence names the platform API the answer was read from
+	Evidence string `json:"evidence"`
+
+	// Member describes the user's membership, for checks that read it
+	Member *MemberInfo `json:"member,omitempty"`
+}
+
+// MemberInfo is a user's membership of a server or community
+type MemberInfo struct {
+	Roles        []string   `json:"roles"` // role IDs
+	Nickname     string     `json:"nickname,omitempty"`
+	JoinedAt     time.Time  `json:"joinedAt"`
+	PremiumSince *time.Time `json:"premiumSince,omitempty"` // when the member started boosting the server
+}
+
+// newCheckResult creates a result checked now
+func newCheckResult(status CheckStatus, reason, evidence string) *CheckResult {
+	return &CheckResult{
+		Status:    status,
+		Reason:    reason,
+		CheckedAt: time.Now().UTC(),
+		Evidence:  evidence,
+	}
+}
+
+// boolResult creates a yes or no result
+func boolResult(ok bool, yesReason, noReason, evidence string) *CheckResult {
+	if ok {
+		return newCheckResult(StatusYes, yesReason, evidence)
+	}
+	return newCheckResult(StatusNo, noReason, evidence)
+}
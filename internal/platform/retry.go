@@ -0,0 +1,122 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy describes how failed idempotent requests to a platform are retried
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts including the first, 1 disables retries
+	BaseDelay   time.Duration // backoff before the first retry, doubled for every further retry
+	MaxDelay    time.Duration // upper bound of a single backoff
+}
+
+// defaultRetryPolicy is used by every platform service in the process
+var defaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 200 * time.Millisecond, MaxDelay: 2 * time.Second}
+
+// SetDefaultRetryPolicy replaces the retry policy used by platform services created afterwards
+func SetDefaultRetryPolicy(policy RetryPolicy) {
+	defaultRetryPolicy = policy
+}
+
+// backoff returns a jittered exponential delay before the given retry, counting from 1
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay << (retry - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// Full jitter spreads retries from many clients over the whole backoff window
+	return rand.N(delay) + 1
+}
+
+// retryTransport sends platform requests through the platform's circuit breaker and retries
+// idempotent requests that fail with a transient error
+type retryTransport struct {
+	upstream string
+	policy   RetryPolicy
+	breakers *Breakers
+	base     http.RoundTripper
+}
+
+// RoundTrip sends a request once the breaker allows it. The breaker counts the request as one
+// failure or success however many attempts it took, so retries cannot open it on their own.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	breaker := t.breakers.get(t.upstream)
+	if err := breaker.allow(t.breakers.cooldown); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.send(req)
+	switch {
+	case upstreamFailed(resp, err):
+		breaker.failure(t.breakers.threshold)
+	case err != nil:
+		breaker.release()
+	default:
+		breaker.success()
+	}
+	return resp, err
+}
+
+// send sends a request, retrying it with backoff while the failure is transient
+func (t *retryTransport) send(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt >= t.policy.MaxAttempts || !retriable(req, resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			// Drain the body so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(t.policy.backoff(attempt))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// upstreamFailed reports whether a request failed because of the platform rather than the caller.
+// Server errors, connection failures and requests that hung past their deadline count;
+// cancelled requests and requests held back by a rate limit or an open breaker do not.
+func upstreamFailed(resp *http.Response, err error) bool {
+	if err != nil {
+		var limitErr *RateLimitError
+		var openErr *CircuitOpenError
+		return !errors.Is(err, context.Canceled) && !errors.As(err, &limitErr) && !errors.As(err, &openErr)
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// retriable reports whether a failed request is worth retrying: only idempotent requests are retried,
+// after a connection failure or a transient server error
+func retriable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if req.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		return upstreamFailed(nil, err) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
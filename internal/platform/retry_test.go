@@ -0,0 +1,150 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	limits := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond}
+
+	for i, limit := range limits {
+		retry := i + 1
+		for range 100 {
+			if delay := policy.backoff(retry); delay <= 0 || delay > limit {
+				t.Fatalf("backoff(%d) = %s, want within (0, %s]", retry, delay, limit)
+			}
+		}
+	}
+
+	// A shift past the width of a duration still stays within the maximum
+	if delay := policy.backoff(80); delay <= 0 || delay > policy.MaxDelay {
+		t.Errorf("backoff(80) = %s, want within (0, %s]", delay, policy.MaxDelay)
+	}
+	if delay := (RetryPolicy{MaxAttempts: 3}).backoff(1); delay != 0 {
+		t.Errorf("backoff without delays = %s, want 0", delay)
+	}
+}
+
+func TestRetriable(t *testing.T) {
+	response := func(status int) *http.Response {
+		return &http.Response{StatusCode: status}
+	}
+	get, _ := http.NewRequest("GET", "https://api.example.com/", nil)
+	post, _ := http.NewRequest("POST", "https://api.example.com/", nil)
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		resp *http.Response
+		err  error
+		want bool
+	}{
+		{"500", get, response(http.StatusInternalServerError), nil, true},
+		{"502", get, response(http.StatusBadGateway), nil, true},
+		{"503", get, response(http.StatusServiceUnavailable), nil, true},
+		{"504", get, response(http.StatusGatewayTimeout), nil, true},
+		{"501", get, response(http.StatusNotImplemented), nil, false},
+		{"429", get, response(http.StatusTooManyRequests), nil, false},
+		{"404", get, response(http.StatusNotFound), nil, false},
+		{"200", get, response(http.StatusOK), nil, false},
+		{"POST 503", post, response(http.StatusServiceUnavailable), nil, false},
+		{"connection error", get, nil, errors.New("connection reset by peer"), true},
+		{"deadline", get, nil, context.DeadlineExceeded, false},
+		{"cancelled", get, nil, context.Canceled, false},
+		{"rate limit budget", get, nil, &RateLimitError{Platform: "twitter"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retriable(tt.req, tt.resp, tt.err); got != tt.want {
+				t.Errorf("retriable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestRetryTransport creates a retry transport with fast retries and its own breakers
+func newTestRetryTransport(base http.RoundTripper, threshold int) *retryTransport {
+	return &retryTransport{
+		upstream: "twitter",
+		policy:   RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		breakers: NewBreakers(threshold, time.Minute),
+		base:     base,
+	}
+}
+
+func TestRetryTransportRetriesTransientFailures(t *testing.T) {
+	attempts := 0
+	transport := newTestRetryTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		status := http.StatusServiceUnavailable
+		if attempts == 3 {
+			status = http.StatusOK
+		}
+		return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+	}), 2)
+
+	req, _ := http.NewRequest("GET", "https://api.example.com/", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("RoundTrip = %v, %v, want 200 after retries", resp, err)
+	}
+	if attempts != 3 {
+		t.Errorf("sent %d attempts, want 3", attempts)
+	}
+	if status := transport.breakers.get("twitter").status(time.Minute); status.ConsecutiveFailures != 0 {
+		t.Errorf("breaker counted %d failures for a request that succeeded", status.ConsecutiveFailures)
+	}
+}
+
+func TestRetryTransportCountsOneFailurePerRequest(t *testing.T) {
+	attempts := 0
+	transport := newTestRetryTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody, Request: req}, nil
+	}), 2)
+	breaker := transport.breakers.get("twitter")
+
+	req, _ := http.NewRequest("GET", "https://api.example.com/", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("sent %d attempts, want 3", attempts)
+	}
+	if status := breaker.status(time.Minute); status.State != BreakerClosed || status.ConsecutiveFailures != 1 {
+		t.Errorf("breaker after one failed request = %+v, want closed with 1 failure", status)
+	}
+
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	if status := breaker.status(time.Minute); status.State != BreakerOpen {
+		t.Errorf("breaker after two failed requests = %+v, want open", status)
+	}
+
+	attempts = 0
+	if _, err := transport.RoundTrip(req); !errors.Is(err, ErrUpstreamUnavailable) || attempts != 0 {
+		t.Errorf("RoundTrip with an open breaker = %v after %d attempts, want a CircuitOpenError", err, attempts)
+	}
+}
+
+func TestRetryTransportDoesNotRetryPOST(t *testing.T) {
+	attempts := 0
+	transport := newTestRetryTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody, Request: req}, nil
+	}), 5)
+
+	req, _ := http.NewRequest("POST", "https://api.example.com/", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("sent %d attempts of a POST, want 1", attempts)
+	}
+}
@@ -0,0 +1,93 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// revokeTokenValues posts each of a token's refresh and access tokens to an RFC 7009 revocation endpoint.
+// Client credentials are sent with HTTP Basic auth when a secret is set, otherwise as form parameters.
+// alreadyRevoked reports whether an error response means the token was already invalid.
+func revokeTokenValues(ctx context.Context, upstream, endpoint, clientID, clientSecret string, token *oauth2.Token, alreadyRevoked func(status int, body []byte) bool) error {
+	values := []struct{ value, hint string }{
+		{token.RefreshToken, "refresh_token"},
+		{token.AccessToken, "access_token"},
+	}
+
+	for _, v := range values {
+		if v.value == "" {
+			continue
+		}
+
+		form := url.Values{
+			"token":           {v.value},
+			"token_type_hint": {v.hint},
+		}
+		if clientSecret == "" {
+			form.Set("client_id", clientID)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if clientSecret != "" {
+			req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+		}
+
+		if err := doRevoke(upstream, req, alreadyRevoked); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// revokeMetaPermissions removes every permission the user granted to the Meta app,
+// which invalidates all of the app's tokens for that user
+func revokeMetaPermissions(ctx context.Context, graphBaseURL string, token *oauth2.Token) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", graphBaseURL+"/me/permissions", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	return doRevoke("meta", req, func(_ int, body []byte) bool {
+		// Error code 190 means the token is already invalid or expired
+		var response struct {
+			Error struct {
+				Code int `json:"code"`
+			} `json:"error"`
+		}
+		return json.Unmarshal(body, &response) == nil && response.Error.Code == 190
+	})
+}
+
+// doRevoke sends a revocation request and treats already revoked tokens as success
+func doRevoke(upstream string, req *http.Request, alreadyRevoked func(status int, body []byte) bool) error {
+	resp, err := newUpstreamClient(upstream).Do(req)
+	if err != nil {
+		return requestError(upstream, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if alreadyRevoked != nil && alreadyRevoked(resp.StatusCode, body) {
+		return nil
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return newAPIError(upstream, resp, nil)
+}
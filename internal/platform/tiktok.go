@@ -1,18 +1,34 @@
 package platform
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"hej/internal/auth"
 	"hej/internal/config"
 
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/facebook" // Instagram uses the same OAuth endpoint as Facebook
 )
 
+// TikTok OAuth endpoints
+func tiktokEndpoint(cfg *config.Config) oauth2.Endpoint {
+	return oauth2.Endpoint{
+		AuthURL:   cfg.TiktokAuthBaseURL + "/v2/auth/authorize/",
+		TokenURL:  cfg.TiktokAPIBaseURL + "/v2/oauth/token/",
+		AuthStyle: oauth2.AuthStyleInParams,
+	}
+}
+
+// tiktokScopes are requested at login and needed by TiktokService
+var tiktokScopes = []string{"user.info.basic", "user.info.profile"}
+
 // TiktokAuthService handles Tiktok authentication
 type TiktokAuthService struct {
 	*auth.OAuthService
@@ -22,165 +38,231 @@ type TiktokAuthService struct {
 // NewTiktokAuthService creates a new Tiktok auth service
 func NewTiktokAuthService(cfg *config.Config) *TiktokAuthService {
 	oauthConfig := &oauth2.Config{
-		ClientID:     cfg.MetaAppID,
-		ClientSecret: cfg.MetaAppSecret,
-		RedirectURL:  cfg.MetaRedirectURI,
-		Scopes:       []string{"user_profile", "instagram_basic"},
-		Endpoint:     facebook.Endpoint,
+		ClientID:     cfg.TiktokClientID,
+		ClientSecret: cfg.TiktokClientSecret,
+		RedirectURL:  cfg.TiktokRedirectURI,
+		Scopes:       tiktokScopes,
+		Endpoint:     tiktokEndpoint(cfg),
 	}
+	oauthService := auth.NewOAuthService("tiktok", oauthConfig)
+	oauthService.EnablePKCE()
+	client := newUpstreamClient("tiktok")
+	client.Transport = &tiktokTokenTransport{base: client.Transport}
+	oauthService.SetHTTPClient(client)
 	return &TiktokAuthService{
-		OAuthService: auth.NewOAuthService(oauthConfig),
+		OAuthService: oauthService,
 		cfg:          cfg,
 	}
 }
 
-// ExchangeToken exchanges an auth code for a token
-func (s *TiktokAuthService) ExchangeToken(code string) (string, error) {
-	token, err := s.ExchangeCode(code)
+// GetAuthURL returns the TikTok consent screen URL and the state it was issued with.
+// TikTok names the client ID client_key and separates scopes with commas.
+func (s *TiktokAuthService) GetAuthURL(opts auth.LoginOptions) (string, string) {
+	authURL, state := s.OAuthService.GetAuthURL(opts)
+
+	u, err := url.Parse(authURL)
 	if err != nil {
-		return "", err
+		return authURL, state
 	}
-	return token.AccessToken, nil
-}
-
-// TiktokProfile represents a Tiktok user profile
-type TiktokProfile struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
+	query := u.Query()
+	query.Set("client_key", query.Get("client_id"))
+	query.Del("client_id")
+	query.Set("scope", strings.Join(strings.Fields(query.Get("scope")), ","))
+	u.RawQuery = query.Encode()
+	return u.String(), state
 }
 
-// TiktokFollowerResponse represents the response from the Tiktok followers API
-type TiktokFollowerResponse struct {
-	Data []struct {
-		ID string `json:"id"`
-	} `json:"data"`
-	Paging struct {
-		Next string `json:"next"`
-	} `json:"paging"`
-}
+// Revoke revokes the session's token with TikTok and deletes the stored copy
+func (s *TiktokAuthService) Revoke(ctx context.Context, sessionID string) error {
+	return s.RevokeSession(ctx, sessionID, func(ctx context.Context, token *oauth2.Token) error {
+		// Revoking the access token ends the whole authorization, including the refresh token
+		form := url.Values{
+			"client_key":    {s.cfg.TiktokClientID},
+			"client_secret": {s.cfg.TiktokClientSecret},
+			"token":         {token.AccessToken},
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", s.cfg.TiktokAPIBaseURL+"/v2/oauth/revoke/", strings.NewReader(form.Encode()))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-// TiktokService represents a Tiktok API service
-type TiktokService struct {
-	accessToken string
-	httpClient  *http.Client
+		return doRevoke("tiktok", req, func(_ int, body []byte) bool {
+			return classifyTiktokError(0, body) == ErrTokenInvalid
+		})
+	})
 }
 
-// NewInstagramService creates a new Instagram service with token
-func NewTiktokService(token string, _ *config.Config) *TiktokService {
-	return &TiktokService{
-		accessToken: token,
-		httpClient:  &http.Client{},
-	}
+// tiktokTokenTransport renames the client_id parameter of token requests to client_key, which is
+// what TikTok's token endpoint expects, for both code exchanges and refreshes
+type tiktokTokenTransport struct {
+	base http.RoundTripper
 }
 
-// IsFollower checks if a user follows another Tiktok user
-func (s *TiktokService) IsFollower(targetUsername string) (bool, error) {
-	if targetUsername == "" {
-		return false, fmt.Errorf("targetUsername is required")
+func (t *tiktokTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "POST" || req.Body == nil || req.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		return t.base.RoundTrip(req)
 	}
 
-	// First, get the user's Tiktok profile ID
-	profile, err := s.getProfile()
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-
-	// Then check if the target user is in the followers list
-	targetProfile, err := s.getUserByUsername(targetUsername)
+	form, err := url.ParseQuery(string(body))
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-
-	isFollowing, err := s.checkFollowing(profile.ID, targetProfile.ID)
-	if err != nil {
-		return false, err
+	if form.Has("client_id") {
+		form.Set("client_key", form.Get("client_id"))
+		form.Del("client_id")
+	}
+	encoded := form.Encode()
+
+	// RoundTrippers must not modify the request they are given
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(strings.NewReader(encoded))
+	req.ContentLength = int64(len(encoded))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(encoded)), nil
 	}
+	return t.base.RoundTrip(req)
+}
 
-	return isFollowing, nil
+// TiktokUser represents a TikTok user profile from the Display API
+type TiktokUser struct {
+	OpenID      string `json:"open_id"` // the user's ID for this app
+	UnionID     string `json:"union_id"`
+	DisplayName string `json:"display_name"`
+	Username    string `json:"username"`
 }
 
-// getProfile gets the authenticated user's Instagram profile
-func (s *TiktokService) getProfile() (*TiktokProfile, error) {
-	// Get the Tiktok user ID from the Tiktok API
-	reqURL := fmt.Sprintf("https://api.tiktok.com/v2/user/info?access_token=%s", s.accessToken)
+// tiktokResponse is the envelope of every Display API response
+type tiktokResponse struct {
+	Data  json.RawMessage `json:"data"`
+	Error tiktokError     `json:"error"`
+}
 
-	resp, err := s.httpClient.Get(reqURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get profile: %w", err)
+// tiktokError is the error of a Display API response; its code is "ok" on success
+type tiktokError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	LogID   string `json:"log_id"`
+}
+
+// classifyTiktokError maps the error codes of TikTok APIs
+func classifyTiktokError(_ int, body []byte) error {
+	var response struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &response) != nil {
+		return nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: %s, %s", resp.Status, string(body))
+	// The Display API reports errors as an object, the OAuth endpoints as a string
+	var apiErr tiktokError
+	if json.Unmarshal(response.Error, &apiErr) != nil {
+		if json.Unmarshal(response.Error, &apiErr.Code) != nil {
+			return nil
+		}
 	}
 
-	var profile TiktokProfile
-	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	switch apiErr.Code {
+	case "access_token_invalid", "invalid_token":
+		return ErrTokenInvalid
+	case "scope_not_authorized", "scope_permission_missed":
+		return ErrMissingScope
+	case "rate_limit_exceeded":
+		return ErrRateLimited
+	case "internal_error":
+		return ErrUpstreamUnavailable
 	}
+	return nil
+}
 
-	return &profile, nil
+// TiktokService represents a Tiktok API service
+type TiktokService struct {
+	tokenSource oauth2.TokenSource
+	httpClient  *http.Client
+	baseURL     string
+	timeout     time.Duration
 }
 
-// getUserByUsername gets a user profile by username
-func (s *TiktokService) getUserByUsername(username string) (*TiktokProfile, error) {
-	// Note: This is a simplified implementation and might need adjustment based on Tiktok's API
-	reqURL := fmt.Sprintf("https://api.tiktok.com/v2/user/info?access_token=%s", s.accessToken)
+// NewTiktokService creates a new Tiktok service with a token source
+func NewTiktokService(tokenSource oauth2.TokenSource, cfg *config.Config) *TiktokService {
+	return &TiktokService{
+		tokenSource: tokenSource,
+		httpClient:  newAuthorizedClient("tiktok", tokenSource),
+		baseURL:     cfg.TiktokAPIBaseURL,
+		timeout:     cfg.TiktokCheckTimeout,
+	}
+}
+
+// CheckFollower checks if a user follows another Tiktok user within the configured check deadline
+func (s *TiktokService) CheckFollower(ctx context.Context, target string) (*CheckResult, error) {
+	return checkWithDeadline(ctx, "tiktok", s.timeout, target, s.checkFollower)
+}
 
-	resp, err := s.httpClient.Get(reqURL)
+// checkFollower checks if a user follows another Tiktok user. The Display API neither lists the
+// accounts a user follows nor looks other users up, so the check confirms the login and answers
+// indeterminate with reason unsupported instead of guessing. The target is not used and may be empty.
+func (s *TiktokService) checkFollower(ctx context.Context, targetUsername string) (*CheckResult, error) {
+	user, err := s.getUserInfo(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user by username: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: %s, %s", resp.Status, string(body))
-	}
+	result := newCheckResult(StatusIndeterminate, ReasonUnsupported, "tiktok.user.info")
+	result.UserID = user.OpenID
+	return result, nil
+}
 
-	var data struct {
-		AuthorName string `json:"author_name"`
-		AuthorID   string `json:"author_id"`
+// TokenInfo returns the user, granted scopes and expiry of the Tiktok token
+func (s *TiktokService) TokenInfo(ctx context.Context) (*TokenInfo, error) {
+	token, err := s.tokenSource.Token()
+	if err != nil {
+		return nil, err
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	user, err := s.getUserInfo(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return &TiktokProfile{
-		ID:       data.AuthorID,
-		Username: data.AuthorName,
-	}, nil
+	handle := user.Username
+	if handle == "" {
+		handle = user.DisplayName
+	}
+	return newTokenInfo("tiktok", user.OpenID, handle, tokenScopes(token), tiktokScopes, token.Expiry), nil
 }
 
-// checkFollowing checks if a user follows another user
-func (s *TiktokService) checkFollowing(userID, targetUserID string) (bool, error) {
-	// Tiktok API to check followers
-	reqURL := fmt.Sprintf("https://api.tiktok.com/v2/user/following?access_token=%s", s.accessToken)
+// getUserInfo gets the authenticated user's TikTok profile
+func (s *TiktokService) getUserInfo(ctx context.Context) (*TiktokUser, error) {
+	query := url.Values{"fields": {"open_id,union_id,display_name,username"}}
 
-	resp, err := s.httpClient.Get(reqURL)
+	resp, err := getWithContext(ctx, s.httpClient, s.baseURL+"/v2/user/info/?"+query.Encode())
 	if err != nil {
-		return false, fmt.Errorf("failed to check following: %w", err)
+		return nil, requestError("tiktok", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return false, fmt.Errorf("API error: %s, %s", resp.Status, string(body))
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, requestError("tiktok", err)
 	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
 
-	var response TiktokFollowerResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return false, fmt.Errorf("failed to decode response: %w", err)
+	// Errors may come with a 200 status, so the error code decides
+	var response tiktokResponse
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &response) != nil || (response.Error.Code != "" && response.Error.Code != "ok") {
+		return nil, newAPIError("tiktok", resp, classifyTiktokError)
 	}
 
-	// Check if target user ID is in the list
-	for _, user := range response.Data {
-		if user.ID == targetUserID {
-			return true, nil
-		}
+	var data struct {
+		User TiktokUser `json:"user"`
 	}
-
-	return false, nil
+	if err := json.Unmarshal(response.Data, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &data.User, nil
 }
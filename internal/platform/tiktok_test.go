@@ -0,0 +1,34 @@
+package platform
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hej/internal/config"
+
+	"golang.org/x/oauth2"
+)
+
+func TestTiktokCheckFollowerWithoutTarget(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": {"user": {"open_id": "open-1", "username": "alice"}}, "error": {"code": "ok"}}`))
+	}))
+	defer upstream.Close()
+
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	service := NewTiktokService(tokenSource, &config.Config{TiktokAPIBaseURL: upstream.URL})
+
+	// The legacy route sends no target, as it did before targets existed
+	for _, target := range []string{"", "bob"} {
+		result, err := service.CheckFollower(context.Background(), target)
+		if err != nil {
+			t.Fatalf("CheckFollower(%q): %v", target, err)
+		}
+		if result.Status != StatusIndeterminate || result.Reason != ReasonUnsupported || result.UserID != "open-1" {
+			t.Errorf("CheckFollower(%q) = %+v, want indeterminate and unsupported for open-1", target, result)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package platform
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// TokenInfo describes the identity and grants behind a session's token
+type TokenInfo struct {
+	Platform          string     `json:"platform"`
+	UserID            string     `json:"userId"`
+	Handle            string     `json:"handle,omitempty"`
+	Scopes            []string   `json:"scopes"`
+	Expiry            *time.Time `json:"expiry,omitempty"`
+	RequiredScopes    []string   `json:"requiredScopes"`
+	MissingScopes     []string   `json:"missingScopes"`
+	HasRequiredScopes bool       `json:"hasRequiredScopes"`
+}
+
+// TokenInspector describes the token a platform service is using
+type TokenInspector interface {
+	// TokenInfo returns the identity, granted scopes and expiry of the token
+	TokenInfo(ctx context.Context) (*TokenInfo, error)
+}
+
+// newTokenInfo builds a TokenInfo and works out which of the required scopes are missing
+func newTokenInfo(platform, userID, handle string, scopes, required []string, expiry time.Time) *TokenInfo {
+	granted := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		granted[scope] = true
+	}
+
+	missing := []string{}
+	for _, scope := range required {
+		if !granted[scope] {
+			missing = append(missing, scope)
+		}
+	}
+
+	info := &TokenInfo{
+		Platform:          platform,
+		UserID:            userID,
+		Handle:            handle,
+		Scopes:            scopes,
+		RequiredScopes:    required,
+		MissingScopes:     missing,
+		HasRequiredScopes: len(missing) == 0,
+	}
+	if info.Scopes == nil {
+		info.Scopes = []string{}
+	}
+	if !expiry.IsZero() {
+		info.Expiry = &expiry
+	}
+	return info
+}
+
+// tokenScopes returns the scopes granted to a token as recorded when it was issued
+func tokenScopes(token *oauth2.Token) []string {
+	scope, _ := token.Extra("scope").(string)
+	return splitScopes(scope)
+}
+
+// splitScopes splits a space- or comma-separated scope list
+func splitScopes(scope string) []string {
+	return strings.FieldsFunc(scope, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+}
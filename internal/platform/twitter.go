@@ -1,11 +1,12 @@
 package platform
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
+	"time"
 
 	"hej/internal/auth"
 	"hej/internal/config"
@@ -14,11 +15,16 @@ import (
 )
 
 // Twitter OAuth endpoints
-var twitterEndpoint = oauth2.Endpoint{
-	AuthURL:  "https://twitter.com/i/oauth2/authorize",
-	TokenURL: "https://api.twitter.com/2/oauth2/token",
+func twitterEndpoint(cfg *config.Config) oauth2.Endpoint {
+	return oauth2.Endpoint{
+		AuthURL:  cfg.TwitterAuthBaseURL + "/i/oauth2/authorize",
+		TokenURL: cfg.TwitterAPIBaseURL + "/2/oauth2/token",
+	}
 }
 
+// twitterScopes are requested at login and needed by TwitterService
+var twitterScopes = []string{"tweet.read", "users.read", "follows.read"}
+
 // TwitterAuthService handles Twitter authentication
 type TwitterAuthService struct {
 	*auth.OAuthService
@@ -31,22 +37,24 @@ func NewTwitterAuthService(cfg *config.Config) *TwitterAuthService {
 		ClientID:     cfg.TwitterClientID,
 		ClientSecret: cfg.TwitterClientSecret,
 		RedirectURL:  cfg.TwitterRedirectURI,
-		Scopes:       []string{"tweet.read", "users.read", "follows.read"},
-		Endpoint:     twitterEndpoint,
+		Scopes:       twitterScopes,
+		Endpoint:     twitterEndpoint(cfg),
 	}
+	// Twitter's OAuth 2.0 authorization code flow requires PKCE
+	oauthService := auth.NewOAuthService("twitter", oauthConfig)
+	oauthService.EnablePKCE()
+	oauthService.SetHTTPClient(newUpstreamClient("twitter"))
 	return &TwitterAuthService{
-		OAuthService: auth.NewOAuthService(oauthConfig),
+		OAuthService: oauthService,
 		cfg:          cfg,
 	}
 }
 
-// ExchangeToken exchanges an auth code for a token
-func (s *TwitterAuthService) ExchangeToken(code string) (string, error) {
-	token, err := s.ExchangeCode(code)
-	if err != nil {
-		return "", err
-	}
-	return token.AccessToken, nil
+// Revoke revokes the session's token with Twitter and deletes the stored copy
+func (s *TwitterAuthService) Revoke(ctx context.Context, sessionID string) error {
+	return s.RevokeSession(ctx, sessionID, func(ctx context.Context, token *oauth2.Token) error {
+		return revokeTokenValues(ctx, "twitter", s.cfg.TwitterAPIBaseURL+"/2/oauth2/revoke", s.cfg.TwitterClientID, s.cfg.TwitterClientSecret, token, nil)
+	})
 }
 
 // TwitterUser represents a Twitter user profile
@@ -72,62 +80,89 @@ type TwitterFollowingResponse struct {
 
 // TwitterService represents a Twitter API service
 type TwitterService struct {
-	accessToken string
+	tokenSource oauth2.TokenSource
 	httpClient  *http.Client
+	baseURL     string
+	timeout     time.Duration
+	pages       PageLimits
 }
 
-// NewTwitterService creates a new Twitter service with token
-func NewTwitterService(token string, _ *config.Config) *TwitterService {
+// NewTwitterService creates a new Twitter service with a token source
+func NewTwitterService(tokenSource oauth2.TokenSource, cfg *config.Config) *TwitterService {
 	return &TwitterService{
-		accessToken: token,
-		httpClient:  &http.Client{},
+		tokenSource: tokenSource,
+		httpClient:  newAuthorizedClient("twitter", tokenSource),
+		baseURL:     cfg.TwitterAPIBaseURL,
+		timeout:     cfg.TwitterCheckTimeout,
+		pages:       pageLimits(cfg),
 	}
 }
 
-// IsFollower checks if a user follows a Twitter account
-func (s *TwitterService) IsFollower(targetUsername string) (bool, error) {
+// CheckFollower checks if a user follows a Twitter account within the configured check deadline
+func (s *TwitterService) CheckFollower(ctx context.Context, target string) (*CheckResult, error) {
+	return checkWithDeadline(ctx, "twitter", s.timeout, target, s.checkFollower)
+}
+
+// checkFollower checks if a user follows a Twitter account
+func (s *TwitterService) checkFollower(ctx context.Context, targetUsername string) (*CheckResult, error) {
 	if targetUsername == "" {
-		return false, fmt.Errorf("target username is required")
+		return nil, fmt.Errorf("target username is required")
 	}
 
 	// First, get the user's profile
-	me, err := s.getProfile()
+	me, err := s.getProfile(ctx)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	// Then get the target user's profile
-	targetUser, err := s.getUserByUsername(targetUsername)
+	targetUser, err := s.getUserByUsername(ctx, targetUsername)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	// Check if the user follows the target
-	isFollowing, err := s.checkFollowing(me.ID, targetUser.ID)
+	scan, err := s.checkFollowing(ctx, me.ID, targetUser.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := scanResult(scan, ReasonFollowing, ReasonNotFollowing, "twitter.users.following")
+	result.UserID = me.ID
+	result.TargetID = targetUser.ID
+	return result, nil
+}
+
+// TokenInfo returns the user, granted scopes and expiry of the Twitter token
+func (s *TwitterService) TokenInfo(ctx context.Context) (*TokenInfo, error) {
+	token, err := s.tokenSource.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	me, err := s.getProfile(ctx)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	return isFollowing, nil
+	return newTokenInfo("twitter", me.ID, me.Username, tokenScopes(token), twitterScopes, token.Expiry), nil
 }
 
 // getProfile gets the authenticated user's Twitter profile
-func (s *TwitterService) getProfile() (*TwitterUser, error) {
-	req, err := http.NewRequest("GET", "https://api.twitter.com/2/users/me", nil)
+func (s *TwitterService) getProfile(ctx context.Context) (*TwitterUser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL+"/2/users/me", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+s.accessToken)
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("API request failed: %w", err)
+		return nil, requestError("twitter", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Twitter API error: %s, %s", resp.Status, string(body))
+		return nil, newAPIError("twitter", resp, nil)
 	}
 
 	var response TwitterUsersResponse
@@ -139,23 +174,21 @@ func (s *TwitterService) getProfile() (*TwitterUser, error) {
 }
 
 // getUserByUsername gets a Twitter user by username
-func (s *TwitterService) getUserByUsername(username string) (*TwitterUser, error) {
-	endpoint := fmt.Sprintf("https://api.twitter.com/2/users/by/username/%s", url.PathEscape(username))
-	req, err := http.NewRequest("GET", endpoint, nil)
+func (s *TwitterService) getUserByUsername(ctx context.Context, username string) (*TwitterUser, error) {
+	endpoint := s.baseURL + "/2/users/by/username/" + url.PathEscape(username)
+	req, err := http.NewRequestWithContext(withRoute(ctx, "/2/users/by/username/{username}"), "GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+s.accessToken)
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("API request failed: %w", err)
+		return nil, requestError("twitter", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Twitter API error: %s, %s", resp.Status, string(body))
+		return nil, newAPIError("twitter", resp, nil)
 	}
 
 	var response TwitterUsersResponse
@@ -163,47 +196,62 @@ func (s *TwitterService) getUserByUsername(username string) (*TwitterUser, error
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	// Unknown usernames are reported in the errors of a 200 response
+	if response.Data.ID == "" {
+		return nil, fmt.Errorf("user %q: %w", username, ErrTargetNotFound)
+	}
+
 	return &response.Data, nil
 }
 
-// checkFollowing checks if a user follows another user
-func (s *TwitterService) checkFollowing(userID, targetUserID string) (bool, error) {
-	endpoint := fmt.Sprintf("https://api.twitter.com/2/users/%s/following", userID)
-	req, err := http.NewRequest("GET", endpoint, nil)
+// checkFollowing checks if a user follows another user, reading the following list page by page
+func (s *TwitterService) checkFollowing(ctx context.Context, userID, targetUserID string) (pageScan, error) {
+	return scanPages(ctx, s.pages, func(ctx context.Context, cursor string) (bool, string, error) {
+		page, err := s.getFollowingPage(ctx, userID, cursor)
+		if err != nil {
+			return false, "", err
+		}
+
+		// Check if the target user is in the list of followed accounts
+		for _, user := range page.Data {
+			if user.ID == targetUserID {
+				return true, "", nil
+			}
+		}
+		return false, page.Meta.NextToken, nil
+	})
+}
+
+// getFollowingPage gets a page of the accounts a user follows, starting at paginationToken
+func (s *TwitterService) getFollowingPage(ctx context.Context, userID, paginationToken string) (*TwitterFollowingResponse, error) {
+	endpoint := fmt.Sprintf("%s/2/users/%s/following", s.baseURL, userID)
+	req, err := http.NewRequestWithContext(withRoute(ctx, "/2/users/{id}/following"), "GET", endpoint, nil)
 	if err != nil {
-		return false, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+s.accessToken)
 
 	// Set query parameters
 	q := req.URL.Query()
-	q.Add("max_results", "100")
+	q.Add("max_results", "1000")
+	if paginationToken != "" {
+		q.Add("pagination_token", paginationToken)
+	}
 	req.URL.RawQuery = q.Encode()
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return false, fmt.Errorf("API request failed: %w", err)
+		return nil, requestError("twitter", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return false, fmt.Errorf("Twitter API error: %s, %s", resp.Status, string(body))
+		return nil, newAPIError("twitter", resp, nil)
 	}
 
 	var response TwitterFollowingResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return false, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	// Check if the target user is in the list of followed accounts
-	for _, user := range response.Data {
-		if user.ID == targetUserID {
-			return true, nil
-		}
+		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	// TODO: Handle pagination if there are more than max_results followers
-
-	return false, nil
+	return &response, nil
 }
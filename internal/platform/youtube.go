@@ -1,22 +1,27 @@
 package platform
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"hej/internal/auth"
 	"hej/internal/config"
 
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 )
 
 type YouTubeSubscription struct {
 	Snippet struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
+		Title       string    `json:"title"`
+		Description string    `json:"description"`
+		PublishedAt time.Time `json:"publishedAt"`
 		ResourceId  struct {
 			ChannelId string `json:"channelId"`
 		} `json:"resourceId"`
@@ -24,9 +29,42 @@ type YouTubeSubscription struct {
 }
 
 type YouTubeSubscriptionResponse struct {
-	Items []YouTubeSubscription `json:"items"`
+	Items         []YouTubeSubscription `json:"items"`
+	NextPageToken string                `json:"nextPageToken"`
 }
 
+// YouTubeChannel represents a YouTube channel
+type YouTubeChannel struct {
+	ID      string `json:"id"`
+	Snippet struct {
+		Title     string `json:"title"`
+		CustomURL string `json:"customUrl"`
+	} `json:"snippet"`
+}
+
+// YouTubeChannelResponse represents the response from the YouTube channels API
+type YouTubeChannelResponse struct {
+	Items []YouTubeChannel `json:"items"`
+}
+
+// googleTokenInfo represents the response from Google's tokeninfo endpoint
+type googleTokenInfo struct {
+	Scope string `json:"scope"`
+	Exp   string `json:"exp"`
+}
+
+// googleEndpoint returns the OAuth endpoint of the configured Google consent screen and token service
+func googleEndpoint(cfg *config.Config) oauth2.Endpoint {
+	return oauth2.Endpoint{
+		AuthURL:   cfg.GoogleAuthBaseURL + "/o/oauth2/auth",
+		TokenURL:  cfg.GoogleOAuthBaseURL + "/token",
+		AuthStyle: oauth2.AuthStyleInParams,
+	}
+}
+
+// youTubeScopes are requested at login and needed by YouTubeService
+var youTubeScopes = []string{"https://www.googleapis.com/auth/youtube.readonly"}
+
 // YouTubeAuthService handles YouTube authentication
 type YouTubeAuthService struct {
 	*auth.OAuthService
@@ -39,91 +77,270 @@ func NewYouTubeAuthService(cfg *config.Config) *YouTubeAuthService {
 		ClientID:     cfg.YouTubeClientID,
 		ClientSecret: cfg.YouTubeClientSecret,
 		RedirectURL:  cfg.YouTubeRedirectURL,
-		Scopes:       []string{"https://www.googleapis.com/auth/youtube.readonly"},
-		Endpoint:     google.Endpoint,
+		Scopes:       youTubeScopes,
+		Endpoint:     googleEndpoint(cfg),
+	}
+	oauthService := auth.NewOAuthService("youtube", oauthConfig)
+	oauthService.SetHTTPClient(newUpstreamClient("google"))
+	if cfg.YouTubePKCE {
+		oauthService.EnablePKCE()
 	}
 	return &YouTubeAuthService{
-		OAuthService: auth.NewOAuthService(oauthConfig),
+		OAuthService: oauthService,
 		cfg:          cfg,
 	}
 }
 
-// ExchangeToken exchanges an auth code for a token
-func (s *YouTubeAuthService) ExchangeToken(code string) (string, error) {
-	token, err := s.ExchangeCode(code)
-	if err != nil {
-		return "", err
-	}
-	return token.AccessToken, nil
+// Revoke revokes the session's token with Google and deletes the stored copy
+func (s *YouTubeAuthService) Revoke(ctx context.Context, sessionID string) error {
+	return s.RevokeSession(ctx, sessionID, func(ctx context.Context, token *oauth2.Token) error {
+		// Google revokes the whole grant when either token is revoked
+		return revokeTokenValues(ctx, "google", s.cfg.GoogleOAuthBaseURL+"/revoke", s.cfg.YouTubeClientID, "", token, func(status int, body []byte) bool {
+			return status == http.StatusBadRequest && strings.Contains(string(body), "invalid_token")
+		})
+	})
 }
 
 // YouTubeService represents a YouTube API service
 type YouTubeService struct {
-	httpClient *http.Client
-	channelID  string
+	tokenSource  oauth2.TokenSource
+	httpClient   *http.Client
+	apiBaseURL   string
+	oauthBaseURL string
+	channelID    string
+	timeout      time.Duration
+	pages        PageLimits
+	resolver     *ChannelResolver
 }
 
-// NewYouTubeService creates a new YouTube service with token
-func NewYouTubeService(token string, cfg *config.Config) *YouTubeService {
+// NewYouTubeService creates a new YouTube service with a token source
+func NewYouTubeService(tokenSource oauth2.TokenSource, cfg *config.Config) *YouTubeService {
+	httpClient := newAuthorizedClient("google", tokenSource)
 	return &YouTubeService{
-		httpClient: &http.Client{
-			Transport: &tokenTransport{token: token},
-		},
-		channelID: cfg.YouTubeChannelID,
+		tokenSource:  tokenSource,
+		httpClient:   httpClient,
+		apiBaseURL:   cfg.YouTubeAPIBaseURL,
+		oauthBaseURL: cfg.GoogleOAuthBaseURL,
+		channelID:    cfg.YouTubeChannelID,
+		timeout:      cfg.YouTubeCheckTimeout,
+		pages:        pageLimits(cfg),
+		resolver:     newAuthorizedChannelResolver(httpClient, cfg),
+	}
+}
+
+// CheckFollower checks if the authenticated user is subscribed to target, or to the configured channel
+// when target is empty, within the configured check deadline. target may be a channel ID, @handle,
+// channel URL or video URL.
+func (s *YouTubeService) CheckFollower(ctx context.Context, target string) (*CheckResult, error) {
+	return checkWithDeadline(ctx, "youtube", s.timeout, target, s.checkFollower)
+}
+
+// checkFollower checks if the authenticated user is subscribed to target or the configured channel
+func (s *YouTubeService) checkFollower(ctx context.Context, target string) (*CheckResult, error) {
+	if target == "" {
+		target = s.channelID
+	}
+	if target == "" {
+		return nil, fmt.Errorf("channel ID is not configured")
+	}
+
+	channelID, err := s.resolver.Resolve(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := s.CheckSubscriptions(ctx, []string{channelID})
+	if err != nil {
+		return nil, err
 	}
+	return results[channelID], nil
 }
 
-// IsFollower checks if the authenticated user is subscribed to the configured channel
-func (s *YouTubeService) IsFollower(_ string) (bool, error) {
-	isSubscribed, _, err := s.GetSubscriptionStatus(s.channelID)
-	return isSubscribed, err
+// youTubeFilterBatch is how many channel IDs fit in one forChannelId filter
+const youTubeFilterBatch = 50
+
+// CheckSubscriptions checks whether the authenticated user is subscribed to each of the given channels,
+// looking them up with the forChannelId filter in batches instead of listing every subscription.
+// The result of each channel carries the subscription date when the user is subscribed.
+func (s *YouTubeService) CheckSubscriptions(ctx context.Context, channelIDs []string) (map[string]*CheckResult, error) {
+	results := make(map[string]*CheckResult, len(channelIDs))
+	for batch := range slices.Chunk(channelIDs, youTubeFilterBatch) {
+		subscriptions := make(map[string]YouTubeSubscription)
+		scan, err := scanPages(ctx, s.pages, func(ctx context.Context, cursor string) (bool, string, error) {
+			page, err := s.getSubscriptionsPage(ctx, batch, cursor)
+			if err != nil {
+				return false, "", err
+			}
+			for _, sub := range page.Items {
+				subscriptions[sub.Snippet.ResourceId.ChannelId] = sub
+			}
+			return len(subscriptions) == len(batch), page.NextPageToken, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, channelID := range batch {
+			sub, ok := subscriptions[channelID]
+			// A channel missing from a filtered list that was not read to the end is unknown, not unsubscribed
+			result := scanResult(pageScan{Found: ok, Complete: scan.Complete || scan.Found}, ReasonSubscribed, ReasonNotSubscribed, "youtube.subscriptions.list")
+			result.TargetID = channelID
+			if ok && !sub.Snippet.PublishedAt.IsZero() {
+				since := sub.Snippet.PublishedAt
+				result.Since = &since
+			}
+			results[channelID] = result
+		}
+	}
+
+	return results, nil
 }
 
-// GetSubscriptionStatus checks if the user is subscribed to a specific channel
-// and optionally returns all subscriptions
-func (s *YouTubeService) GetSubscriptionStatus(channelID string) (bool, []YouTubeSubscription, error) {
-	url := "https://youtube.googleapis.com/youtube/v3/subscriptions?part=snippet&mine=true&maxResults=50"
+// ListSubscriptions lists every subscription of the authenticated user, page by page within the
+// configured page limits. complete is false when a limit ran out before the end of the list.
+func (s *YouTubeService) ListSubscriptions(ctx context.Context) (subscriptions []YouTubeSubscription, complete bool, err error) {
+	scan, err := scanPages(ctx, s.pages, func(ctx context.Context, cursor string) (bool, string, error) {
+		page, err := s.getSubscriptionsPage(ctx, nil, cursor)
+		if err != nil {
+			return false, "", err
+		}
+		subscriptions = append(subscriptions, page.Items...)
+		return false, page.NextPageToken, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return subscriptions, scan.Complete, nil
+}
 
-	req, err := http.NewRequest("GET", url, nil)
+// getSubscriptionsPage gets a page of the authenticated user's subscriptions, starting at pageToken.
+// When forChannelIDs is set, only subscriptions to those channels are returned.
+func (s *YouTubeService) getSubscriptionsPage(ctx context.Context, forChannelIDs []string, pageToken string) (*YouTubeSubscriptionResponse, error) {
+	query := url.Values{
+		"part":       {"snippet"},
+		"mine":       {"true"},
+		"maxResults": {"50"},
+	}
+	if len(forChannelIDs) > 0 {
+		query.Set("forChannelId", strings.Join(forChannelIDs, ","))
+	}
+	if pageToken != "" {
+		query.Set("pageToken", pageToken)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.apiBaseURL+"/youtube/v3/subscriptions?"+query.Encode(), nil)
 	if err != nil {
-		return false, nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return false, nil, fmt.Errorf("API request failed: %w", err)
+		return nil, requestError("youtube", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return false, nil, fmt.Errorf("API error: %s, %s", resp.Status, string(body))
+		return nil, newAPIError("youtube", resp, classifyGoogleError)
 	}
 
 	var response YouTubeSubscriptionResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return false, nil, fmt.Errorf("failed to decode response: %w", err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	// Check for specific channel subscription if channelID was provided
-	if channelID != "" {
-		for _, sub := range response.Items {
-			if sub.Snippet.ResourceId.ChannelId == channelID {
-				return true, response.Items, nil
-			}
-		}
-		return false, response.Items, nil
+	return &response, nil
+}
+
+// TokenInfo returns the channel, granted scopes and expiry of the YouTube token
+func (s *YouTubeService) TokenInfo(ctx context.Context) (*TokenInfo, error) {
+	token, err := s.tokenSource.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.getTokenInfo(ctx, token.AccessToken)
+	if err != nil {
+		return nil, err
 	}
 
-	return false, response.Items, nil
+	channel, err := s.getMyChannel(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	handle := channel.Snippet.CustomURL
+	if handle == "" {
+		handle = channel.Snippet.Title
+	}
+
+	expiry := token.Expiry
+	if exp, err := strconv.ParseInt(info.Exp, 10, 64); err == nil {
+		expiry = time.Unix(exp, 0)
+	}
+
+	return newTokenInfo("youtube", channel.ID, handle, splitScopes(info.Scope), youTubeScopes, expiry), nil
 }
 
-// tokenTransport is an http.RoundTripper that adds the token to requests
-type tokenTransport struct {
-	token string
+// getTokenInfo asks Google which scopes and expiry an access token has
+func (s *YouTubeService) getTokenInfo(ctx context.Context, accessToken string) (*googleTokenInfo, error) {
+	form := url.Values{"access_token": {accessToken}}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.oauthBaseURL+"/tokeninfo", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, requestError("youtube", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError("youtube", resp, classifyTokenInfoError)
+	}
+
+	var info googleTokenInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &info, nil
 }
 
-func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	req.Header.Add("Authorization", "Bearer "+t.token)
-	return http.DefaultTransport.RoundTrip(req)
+// classifyTokenInfoError maps tokeninfo errors, which are reported as 400 for invalid or expired tokens
+func classifyTokenInfoError(status int, _ []byte) error {
+	if status == http.StatusBadRequest {
+		return ErrTokenInvalid
+	}
+	return nil
+}
+
+// getMyChannel gets the authenticated user's YouTube channel
+func (s *YouTubeService) getMyChannel(ctx context.Context) (*YouTubeChannel, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.apiBaseURL+"/youtube/v3/channels?part=snippet&mine=true", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, requestError("youtube", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError("youtube", resp, classifyGoogleError)
+	}
+
+	var response YouTubeChannelResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(response.Items) == 0 {
+		return nil, fmt.Errorf("account has no YouTube channel")
+	}
+	return &response.Items[0], nil
 }
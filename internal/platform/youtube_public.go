@@ -0,0 +1,80 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"hej/internal/config"
+)
+
+// YouTubePublicService checks public subscriptions with the app's API key, without a Google login
+type YouTubePublicService struct {
+	timeout  time.Duration
+	resolver *ChannelResolver // sends the service's API requests as well, with the API key
+}
+
+// NewYouTubePublicService creates a new YouTube service that authenticates with the configured API key
+func NewYouTubePublicService(cfg *config.Config) *YouTubePublicService {
+	return &YouTubePublicService{
+		timeout:  cfg.YouTubeCheckTimeout,
+		resolver: NewChannelResolver(cfg),
+	}
+}
+
+// CheckPublic checks if the channel subscriber publicly subscribes to channel within the configured
+// check deadline. Both channels may be given as a channel ID, @handle, channel URL or video URL. A
+// private subscription list is not an error: the check answers indeterminate with reason
+// following_private, so the caller can ask for a login.
+func (s *YouTubePublicService) CheckPublic(ctx context.Context, subscriber, channel string) (*CheckResult, error) {
+	return checkWithDeadline(ctx, "youtube", s.timeout, channel, func(ctx context.Context, channel string) (*CheckResult, error) {
+		return s.checkPublic(ctx, subscriber, channel)
+	})
+}
+
+// checkPublic checks if a channel publicly subscribes to another
+func (s *YouTubePublicService) checkPublic(ctx context.Context, subscriber, channel string) (*CheckResult, error) {
+	if s.resolver.apiKey == "" {
+		return nil, fmt.Errorf("YouTube API key is not configured")
+	}
+	if channel == "" {
+		return nil, fmt.Errorf("channel ID is not configured")
+	}
+
+	channelID, err := s.resolver.Resolve(ctx, channel)
+	if err != nil {
+		return nil, err
+	}
+	subscriberID, err := s.resolver.Resolve(ctx, subscriber)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{
+		"part":         {"snippet"},
+		"channelId":    {subscriberID},
+		"forChannelId": {channelID},
+	}
+	var response YouTubeSubscriptionResponse
+	err = s.resolver.get(ctx, "/youtube/v3/subscriptions", query, &response)
+	if errors.Is(err, ErrFollowingPrivate) {
+		result := newCheckResult(StatusIndeterminate, ReasonFollowingPrivate, "youtube.subscriptions.list")
+		result.UserID = subscriberID
+		result.TargetID = channelID
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := boolResult(len(response.Items) > 0, ReasonSubscribed, ReasonNotSubscribed, "youtube.subscriptions.list")
+	result.UserID = subscriberID
+	result.TargetID = channelID
+	if len(response.Items) > 0 && !response.Items[0].Snippet.PublishedAt.IsZero() {
+		since := response.Items[0].Snippet.PublishedAt
+		result.Since = &since
+	}
+	return result, nil
+}
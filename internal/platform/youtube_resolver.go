@@ -0,0 +1,263 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"hej/internal/config"
+)
+
+// channelCacheTTL is how long a resolved channel ID is reused; handles and usernames rarely move
+const channelCacheTTL = 24 * time.Hour
+
+var (
+	youTubeChannelIDPattern = regexp.MustCompile(`^UC[0-9A-Za-z_-]{22}$`)
+	youTubeVideoIDPattern   = regexp.MustCompile(`^[0-9A-Za-z_-]{11}$`)
+	youTubeHandlePattern    = regexp.MustCompile(`^@[0-9A-Za-z_.-]{3,30}$`)
+)
+
+// channelRef is a parsed reference to a YouTube channel
+type channelRef struct {
+	kind  string // "id", "handle", "username" or "video"
+	value string
+}
+
+// channelCache remembers resolved channel IDs
+type channelCache struct {
+	mu      sync.Mutex
+	entries map[channelRef]channelCacheEntry
+}
+
+type channelCacheEntry struct {
+	channelID string
+	expires   time.Time
+}
+
+// defaultChannelCache is shared by every resolver in the process
+var defaultChannelCache = &channelCache{entries: make(map[channelRef]channelCacheEntry)}
+
+func (c *channelCache) get(ref channelRef) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[ref]
+	if !ok || time.Now().After(entry.expires) {
+		delete(c.entries, ref)
+		return "", false
+	}
+	return entry.channelID, true
+}
+
+func (c *channelCache) put(ref channelRef, channelID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[ref] = channelCacheEntry{channelID: channelID, expires: time.Now().Add(channelCacheTTL)}
+}
+
+// ChannelResolver resolves the ways people refer to a YouTube channel, such as @handles, channel URLs
+// and video links, to the channel's ID through the Data API
+type ChannelResolver struct {
+	httpClient *http.Client // nil when there is neither an API key nor a login to call the API with
+	apiKey     string       // sent with every request when set, otherwise httpClient authorizes requests
+	apiBaseURL string
+	cache      *channelCache
+}
+
+// NewChannelResolver creates a resolver that authenticates with the configured API key.
+// Without a key it only accepts channel IDs and cached references.
+func NewChannelResolver(cfg *config.Config) *ChannelResolver {
+	resolver := &ChannelResolver{
+		apiKey:     cfg.YouTubeAPIKey,
+		apiBaseURL: cfg.YouTubeAPIBaseURL,
+		cache:      defaultChannelCache,
+	}
+	if cfg.YouTubeAPIKey != "" {
+		resolver.httpClient = newUpstreamClient("google")
+	}
+	return resolver
+}
+
+// newAuthorizedChannelResolver creates a resolver that calls the API with a logged-in user's client
+func newAuthorizedChannelResolver(httpClient *http.Client, cfg *config.Config) *ChannelResolver {
+	return &ChannelResolver{
+		httpClient: httpClient,
+		apiBaseURL: cfg.YouTubeAPIBaseURL,
+		cache:      defaultChannelCache,
+	}
+}
+
+// Resolve returns the channel ID of a channel ID, @handle, youtube.com channel or handle URL, or
+// video URL. Input that is none of these fails with ErrInvalidTarget, and references to channels
+// or videos that do not exist fail with ErrTargetNotFound.
+func (r *ChannelResolver) Resolve(ctx context.Context, input string) (string, error) {
+	ref, err := parseChannelRef(input)
+	if err != nil {
+		return "", err
+	}
+	if ref.kind == "id" {
+		return ref.value, nil
+	}
+
+	if channelID, ok := r.cache.get(ref); ok {
+		return channelID, nil
+	}
+	if r.httpClient == nil {
+		return "", fmt.Errorf("resolving %q to a channel ID needs YT_API_KEY: %w", input, ErrInvalidTarget)
+	}
+
+	var channelID string
+	switch ref.kind {
+	case "video":
+		channelID, err = r.videoChannel(ctx, ref.value)
+	default:
+		channelID, err = r.lookupChannel(ctx, ref)
+	}
+	if err != nil {
+		return "", fmt.Errorf("resolving YouTube channel %q: %w", input, err)
+	}
+
+	r.cache.put(ref, channelID)
+	return channelID, nil
+}
+
+// ValidateChannelRef checks that input is a channel ID, @handle, channel URL or video URL without
+// resolving it, failing with ErrInvalidTarget otherwise
+func ValidateChannelRef(input string) error {
+	_, err := parseChannelRef(input)
+	return err
+}
+
+// parseChannelRef works out what kind of channel reference input is
+func parseChannelRef(input string) (channelRef, error) {
+	input = strings.TrimSpace(input)
+	switch {
+	case youTubeChannelIDPattern.MatchString(input):
+		return channelRef{"id", input}, nil
+	case youTubeHandlePattern.MatchString(input):
+		return channelRef{"handle", strings.ToLower(input)}, nil
+	}
+
+	invalid := fmt.Errorf("%q is not a YouTube channel ID, handle, channel URL or video URL: %w", input, ErrInvalidTarget)
+
+	raw := input
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return channelRef{}, invalid
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, prefix := range []string{"www.", "m.", "music."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+
+	var ref channelRef
+	switch {
+	case host == "youtu.be" && len(segments) == 1:
+		ref = channelRef{"video", segments[0]}
+	case host != "youtube.com" || len(segments) == 0:
+		return channelRef{}, invalid
+	case segments[0] == "watch":
+		ref = channelRef{"video", u.Query().Get("v")}
+	case len(segments) == 2 && (segments[0] == "shorts" || segments[0] == "live" || segments[0] == "embed"):
+		ref = channelRef{"video", segments[1]}
+	case len(segments) >= 2 && segments[0] == "channel":
+		ref = channelRef{"id", segments[1]}
+	case len(segments) >= 2 && segments[0] == "user":
+		ref = channelRef{"username", segments[1]}
+	case strings.HasPrefix(segments[0], "@"):
+		ref = channelRef{"handle", strings.ToLower(segments[0])}
+	default:
+		// Custom URLs (youtube.com/c/Name and youtube.com/Name) cannot be looked up, and the handle of
+		// the same name may belong to another channel
+		return channelRef{}, fmt.Errorf("%q is a custom URL, which cannot be resolved reliably; use the channel's @handle, channel ID or a video URL instead: %w", input, ErrInvalidTarget)
+	}
+
+	valid := true
+	switch ref.kind {
+	case "id":
+		valid = youTubeChannelIDPattern.MatchString(ref.value)
+	case "video":
+		valid = youTubeVideoIDPattern.MatchString(ref.value)
+	case "handle":
+		valid = youTubeHandlePattern.MatchString(ref.value)
+	}
+	if !valid {
+		return channelRef{}, invalid
+	}
+	return ref, nil
+}
+
+// lookupChannel finds a channel by handle or legacy username
+func (r *ChannelResolver) lookupChannel(ctx context.Context, ref channelRef) (string, error) {
+	query := url.Values{"part": {"id"}}
+	if ref.kind == "username" {
+		query.Set("forUsername", ref.value)
+	} else {
+		query.Set("forHandle", ref.value)
+	}
+
+	var response YouTubeChannelResponse
+	if err := r.get(ctx, "/youtube/v3/channels", query, &response); err != nil {
+		return "", err
+	}
+	if len(response.Items) == 0 {
+		return "", ErrTargetNotFound
+	}
+	return response.Items[0].ID, nil
+}
+
+// videoChannel finds the channel that uploaded a video
+func (r *ChannelResolver) videoChannel(ctx context.Context, videoID string) (string, error) {
+	var response struct {
+		Items []struct {
+			Snippet struct {
+				ChannelID string `json:"channelId"`
+			} `json:"snippet"`
+		} `json:"items"`
+	}
+	if err := r.get(ctx, "/youtube/v3/videos", url.Values{"part": {"snippet"}, "id": {videoID}}, &response); err != nil {
+		return "", err
+	}
+	if len(response.Items) == 0 || response.Items[0].Snippet.ChannelID == "" {
+		return "", ErrTargetNotFound
+	}
+	return response.Items[0].Snippet.ChannelID, nil
+}
+
+// get sends a Data API request and decodes the response into v
+func (r *ChannelResolver) get(ctx context.Context, path string, query url.Values, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", r.apiBaseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if r.apiKey != "" {
+		// The key goes in a header rather than the query so it never shows up in logged request URLs
+		req.Header.Set("X-Goog-Api-Key", r.apiKey)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return requestError("youtube", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError("youtube", resp, classifyGoogleError)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -8,13 +8,16 @@ import (
 
 // Router handles routing HTTP requests
 type Router struct {
-	cfg *config.Config
+	cfg     *config.Config
+	sandbox http.Handler
 }
 
-// NewRouter creates a new router instance
-func NewRouter(cfg *config.Config) *Router {
+// NewRouter creates a new router instance. sandbox serves the simulated platform APIs
+// and is nil unless sandbox mode is on.
+func NewRouter(cfg *config.Config, sandbox http.Handler) *Router {
 	return &Router{
-		cfg: cfg,
+		cfg:     cfg,
+		sandbox: sandbox,
 	}
 }
 
@@ -27,33 +30,66 @@ func (r *Router) Setup() {
 	discordHandler := handler.NewDiscordHandler(r.cfg)
 	twitterHandler := handler.NewTwitterHandler(r.cfg)
 	tiktokHandler := handler.NewTiktokHandler(r.cfg)
+	checkHandler := handler.NewCheckHandler(r.cfg)
+	adminHandler := handler.NewAdminHandler(r.cfg)
+
+	// Versioned check API
+	http.HandleFunc("POST /v1/{platform}/check", checkHandler.Check)
+
+	// Admin routes
+	http.HandleFunc("GET /admin/status", adminHandler.Status)
+	http.HandleFunc("POST /admin/discord/members/check", adminHandler.CheckDiscordMembers)
+
+	// Simulated platform APIs
+	if r.sandbox != nil {
+		http.Handle("/sandbox/", http.StripPrefix("/sandbox", r.sandbox))
+	}
+
 	// YouTube routes
 	http.HandleFunc("/youtube/login", youtubeHandler.Login)
 	http.HandleFunc("/youtube/callback", youtubeHandler.Callback)
-	http.HandleFunc("/youtube/check-subscription", youtubeHandler.CheckSubscription)
+	http.HandleFunc("/youtube/logout", youtubeHandler.Logout)
+	http.HandleFunc("/youtube/revoke", youtubeHandler.Revoke)
+	http.HandleFunc("/youtube/token-info", youtubeHandler.TokenInfo)
+	http.HandleFunc("/youtube/check-subscription", handler.Deprecated("/v1/youtube/check", youtubeHandler.CheckSubscription))
 
 	// Facebook routes
 	http.HandleFunc("/facebook/login", facebookHandler.Login)
 	http.HandleFunc("/facebook/callback", facebookHandler.Callback)
-	http.HandleFunc("/facebook/check-follower", facebookHandler.CheckFollower)
+	http.HandleFunc("/facebook/logout", facebookHandler.Logout)
+	http.HandleFunc("/facebook/revoke", facebookHandler.Revoke)
+	http.HandleFunc("/facebook/token-info", facebookHandler.TokenInfo)
+	http.HandleFunc("/facebook/check-follower", handler.Deprecated("/v1/facebook/check", facebookHandler.CheckFollower))
 
 	// Instagram routes
 	http.HandleFunc("/instagram/login", instagramHandler.Login)
 	http.HandleFunc("/instagram/callback", instagramHandler.Callback)
-	http.HandleFunc("/instagram/check-follower", instagramHandler.CheckFollower)
+	http.HandleFunc("/instagram/logout", instagramHandler.Logout)
+	http.HandleFunc("/instagram/revoke", instagramHandler.Revoke)
+	http.HandleFunc("/instagram/token-info", instagramHandler.TokenInfo)
+	http.HandleFunc("/instagram/check-follower", handler.Deprecated("/v1/instagram/check", instagramHandler.CheckFollower))
 
 	// Discord routes
 	http.HandleFunc("/discord/login", discordHandler.Login)
 	http.HandleFunc("/discord/callback", discordHandler.Callback)
-	http.HandleFunc("/discord/check-server", discordHandler.CheckServerMembership)
+	http.HandleFunc("/discord/logout", discordHandler.Logout)
+	http.HandleFunc("/discord/revoke", discordHandler.Revoke)
+	http.HandleFunc("/discord/token-info", discordHandler.TokenInfo)
+	http.HandleFunc("/discord/check-server", handler.Deprecated("/v1/discord/check", discordHandler.CheckServerMembership))
 
 	// Twitter routes
 	http.HandleFunc("/twitter/login", twitterHandler.Login)
 	http.HandleFunc("/twitter/callback", twitterHandler.Callback)
-	http.HandleFunc("/twitter/check-follower", twitterHandler.CheckFollower)
+	http.HandleFunc("/twitter/logout", twitterHandler.Logout)
+	http.HandleFunc("/twitter/revoke", twitterHandler.Revoke)
+	http.HandleFunc("/twitter/token-info", twitterHandler.TokenInfo)
+	http.HandleFunc("/twitter/check-follower", handler.Deprecated("/v1/twitter/check", twitterHandler.CheckFollower))
 
 	//tiktok routes
 	http.HandleFunc("/tiktok/login", tiktokHandler.Login)
 	http.HandleFunc("/tiktok/callback", tiktokHandler.Callback)
-	http.HandleFunc("/tiktok/check-follower", tiktokHandler.CheckFollower)
+	http.HandleFunc("/tiktok/logout", tiktokHandler.Logout)
+	http.HandleFunc("/tiktok/revoke", tiktokHandler.Revoke)
+	http.HandleFunc("/tiktok/token-info", tiktokHandler.TokenInfo)
+	http.HandleFunc("/tiktok/check-follower", handler.Deprecated("/v1/tiktok/check", tiktokHandler.CheckFollower))
 }
@@ -0,0 +1,787 @@
+package sandbox
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// registerAPIs adds the simulated platform APIs
+func (s *Simulator) registerAPIs(mux *http.ServeMux) {
+	// Google
+	mux.HandleFunc("POST /google/tokeninfo", s.googleTokenInfo)
+	mux.HandleFunc("GET /google/tokeninfo", s.googleTokenInfo)
+	mux.HandleFunc("GET /google/youtube/v3/subscriptions", s.youTubeSubscriptions)
+	mux.HandleFunc("GET /google/youtube/v3/channels", s.youTubeChannels)
+	mux.HandleFunc("GET /google/youtube/v3/videos", s.youTubeVideos)
+
+	// Meta
+	mux.HandleFunc("GET /meta/me", s.metaProfile)
+	mux.HandleFunc("GET /meta/debug_token", s.metaDebugToken)
+	mux.HandleFunc("DELETE /meta/me/permissions", s.metaRevokePermissions)
+	mux.HandleFunc("GET /meta/me/permissions", s.metaPermissions)
+	mux.HandleFunc("GET /meta/me/likes/{page}", s.metaLikes)
+	mux.HandleFunc("GET /meta/me/accounts", s.metaPages)
+	mux.HandleFunc("GET /meta/{id}", s.metaObject)
+	mux.HandleFunc("GET /meta/{id}/media", s.instagramMedia)
+
+	// Discord
+	mux.HandleFunc("GET /discord/oauth2/@me", s.discordAuthorization)
+	mux.HandleFunc("GET /discord/users/@me", s.discordUser)
+	mux.HandleFunc("GET /discord/users/@me/guilds", s.discordGuilds)
+	mux.HandleFunc("GET /discord/users/@me/guilds/{guild}/member", s.discordMember)
+	mux.HandleFunc("GET /discord/guilds/{guild}/members", s.discordGuildMembers)
+	mux.HandleFunc("GET /discord/guilds/{guild}/members/{user}", s.discordGuildMember)
+
+	// Twitter
+	mux.HandleFunc("GET /twitter/2/users/me", s.twitterMe)
+	mux.HandleFunc("GET /twitter/2/users/by/username/{username}", s.twitterUserByUsername)
+	mux.HandleFunc("GET /twitter/2/users/{id}/following", s.twitterFollowing)
+
+	// TikTok
+	mux.HandleFunc("GET /tiktok/v2/user/info/", s.tiktokUserInfo)
+}
+
+// channelID returns a user's YouTube channel ID
+func channelID(user *User) string {
+	if user.ChannelID != "" {
+		return user.ChannelID
+	}
+	// Real channel IDs are "UC" followed by 22 characters
+	return "UC" + strings.Repeat("0", max(22-len(user.ID), 0)) + user.ID
+}
+
+// findChannel looks the owner of a YouTube channel up by channel ID
+func (s *Simulator) findChannel(id string) *User {
+	for i := range s.users {
+		if channelID(&s.users[i]) == id {
+			return &s.users[i]
+		}
+	}
+	return nil
+}
+
+// account is an entry of a follow list, either a scripted user or an account the scenario only names
+type account struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
+// follows resolves the accounts a user follows
+func (s *Simulator) follows(user *User) []account {
+	accounts := make([]account, 0, len(user.Follows))
+	for _, key := range user.Follows {
+		if followed := s.findUser(key); followed != nil {
+			accounts = append(accounts, account{followed.ID, followed.Name, followed.Username})
+		} else {
+			accounts = append(accounts, account{key, key, key})
+		}
+	}
+	return accounts
+}
+
+// pageSizeFor returns how many items a list request gets: the scenario's page size when set,
+// otherwise the requested size within the platform's bounds
+func (s *Simulator) pageSizeFor(requested string, defaultSize, maxSize int) int {
+	if s.pageSize > 0 {
+		return s.pageSize
+	}
+	if n, err := strconv.Atoi(requested); err == nil && n > 0 {
+		return min(n, maxSize)
+	}
+	return defaultSize
+}
+
+// paginate returns the page of items starting at the offset encoded in token,
+// and the token of the next page or "" on the last page
+func paginate[T any](items []T, token string, size int) ([]T, string) {
+	offset, _ := strconv.Atoi(strings.TrimPrefix(token, "page-"))
+	if offset < 0 || offset > len(items) {
+		offset = len(items)
+	}
+	end := min(offset+size, len(items))
+	if end == len(items) {
+		return items[offset:end], ""
+	}
+	return items[offset:end], "page-" + strconv.Itoa(end)
+}
+
+// nextURL returns the absolute URL of the request with a query parameter replaced,
+// as Graph API paging links are
+func nextURL(r *http.Request, key, value string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	query := r.URL.Query()
+	query.Set(key, value)
+	u := url.URL{Scheme: scheme, Host: r.Host, Path: requestPath(r), RawQuery: query.Encode()}
+	return u.String()
+}
+
+// googleTokenInfo reports the scopes and expiry of an access token
+func (s *Simulator) googleTokenInfo(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, "invalid_request")
+		return
+	}
+
+	g := s.lookupToken(r.Form.Get("access_token"), "google")
+	if g == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_token", "error_description": "Invalid Value"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"azp":        g.clientID,
+		"aud":        g.clientID,
+		"sub":        g.userID,
+		"scope":      strings.Join(g.scopes, " "),
+		"exp":        strconv.FormatInt(g.expiry.Unix(), 10),
+		"expires_in": strconv.Itoa(int(time.Until(g.expiry).Seconds())),
+	})
+}
+
+// googleCaller authenticates a Data API request with a bearer token or an API key. Any key is accepted;
+// key requests have no user and can only read public data.
+func (s *Simulator) googleCaller(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	if r.Header.Get("Authorization") == "" && (r.Header.Get("X-Goog-Api-Key") != "" || r.URL.Query().Get("key") != "") {
+		return nil, true
+	}
+	me, _ := s.authenticate(w, r, "google")
+	return me, me != nil
+}
+
+// youTubeSubscriptions lists the channels the authenticated user, or the owner of channelId, is subscribed to
+func (s *Simulator) youTubeSubscriptions(w http.ResponseWriter, r *http.Request) {
+	me, ok := s.googleCaller(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	subscriber := me
+	if id := query.Get("channelId"); id != "" && query.Get("mine") != "true" {
+		subscriber = s.findChannel(id)
+		if subscriber == nil {
+			writeGoogleError(w, http.StatusNotFound, "subscriberNotFound", "The subscriber identified with the request cannot be found.")
+			return
+		}
+		if subscriber != me && subscriber.PrivateFollowing {
+			writeGoogleError(w, http.StatusForbidden, "subscriptionForbidden", "The requester is not allowed to access the requested subscriptions.")
+			return
+		}
+	}
+	if subscriber == nil {
+		writeGoogleError(w, http.StatusUnauthorized, "authError", "Listing your own subscriptions requires OAuth authorization.")
+		return
+	}
+
+	var filter []string
+	if forChannelID := query.Get("forChannelId"); forChannelID != "" {
+		filter = strings.Split(forChannelID, ",")
+	}
+
+	type item struct {
+		ID      string         `json:"id"`
+		Snippet map[string]any `json:"snippet"`
+	}
+	items := []item{}
+	for i, key := range subscriber.Subscriptions {
+		id, title := key, key
+		if channel := s.findUser(key); channel != nil {
+			id, title = channelID(channel), channel.Name
+		} else if channel := s.findChannel(key); channel != nil {
+			title = channel.Name
+		}
+		if filter != nil && !slices.Contains(filter, id) {
+			continue
+		}
+		items = append(items, item{
+			ID: fmt.Sprintf("sub-%s-%s", subscriber.ID, id),
+			Snippet: map[string]any{
+				"title":       title,
+				"publishedAt": time.Date(2024, 1, 1+i, 0, 0, 0, 0, time.UTC),
+				"resourceId":  map[string]string{"kind": "youtube#channel", "channelId": id},
+			},
+		})
+	}
+
+	page, next := paginate(items, query.Get("pageToken"), s.pageSizeFor(query.Get("maxResults"), 5, 50))
+	body := map[string]any{
+		"kind":     "youtube#subscriptionListResponse",
+		"pageInfo": map[string]int{"totalResults": len(items), "resultsPerPage": len(page)},
+		"items":    page,
+	}
+	if next != "" {
+		body["nextPageToken"] = next
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// youTubeChannels looks channels up by mine, id, forHandle or forUsername
+func (s *Simulator) youTubeChannels(w http.ResponseWriter, r *http.Request) {
+	me, ok := s.googleCaller(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	var owners []*User
+	switch {
+	case query.Get("mine") == "true" && me == nil:
+		writeGoogleError(w, http.StatusUnauthorized, "authError", "Looking up your own channel requires OAuth authorization.")
+		return
+	case query.Get("mine") == "true":
+		owners = append(owners, me)
+	case query.Get("id") != "":
+		for _, id := range strings.Split(query.Get("id"), ",") {
+			if owner := s.findChannel(id); owner != nil {
+				owners = append(owners, owner)
+			}
+		}
+	case query.Get("forHandle") != "":
+		// Handles are case-insensitive
+		handle := strings.TrimPrefix(query.Get("forHandle"), "@")
+		for i := range s.users {
+			if strings.EqualFold(s.users[i].Username, handle) {
+				owners = append(owners, &s.users[i])
+			}
+		}
+	case query.Get("forUsername") != "":
+		if owner := s.findUser(query.Get("forUsername")); owner != nil {
+			owners = append(owners, owner)
+		}
+	}
+
+	items := []map[string]any{}
+	for _, owner := range owners {
+		items = append(items, map[string]any{
+			"id": channelID(owner),
+			"snippet": map[string]string{
+				"title":     owner.Name,
+				"customUrl": "@" + owner.Username,
+			},
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"kind": "youtube#channelListResponse", "items": items})
+}
+
+// youTubeVideos looks videos up by id and names the channel that uploaded each
+func (s *Simulator) youTubeVideos(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.googleCaller(w, r); !ok {
+		return
+	}
+
+	items := []map[string]any{}
+	for _, id := range strings.Split(r.URL.Query().Get("id"), ",") {
+		for i := range s.users {
+			if slices.Contains(s.users[i].Videos, id) {
+				items = append(items, map[string]any{
+					"id": id,
+					"snippet": map[string]string{
+						"channelId":    channelID(&s.users[i]),
+						"channelTitle": s.users[i].Name,
+					},
+				})
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"kind": "youtube#videoListResponse", "items": items})
+}
+
+// metaProfile returns the authenticated user's profile
+func (s *Simulator) metaProfile(w http.ResponseWriter, r *http.Request) {
+	me, _ := s.authenticate(w, r, "meta")
+	if me == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, account{me.ID, me.Name, me.Username})
+}
+
+// metaDebugToken inspects a user access token. The app token is required but not checked.
+func (s *Simulator) metaDebugToken(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if !strings.Contains(query.Get("access_token"), "|") {
+		writeMetaError(w, http.StatusBadRequest, 190, "An app access token is required")
+		return
+	}
+
+	g := s.lookupToken(query.Get("input_token"), "meta")
+	if g == nil {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"data": map[string]any{"is_valid": false, "error": map[string]any{"code": 190, "message": "Invalid OAuth access token"}},
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data": map[string]any{
+			"app_id":     g.clientID,
+			"user_id":    g.userID,
+			"is_valid":   true,
+			"expires_at": g.expiry.Unix(),
+			"scopes":     g.scopes,
+		},
+	})
+}
+
+// metaRevokePermissions removes the app's permissions, which revokes every token of the user
+func (s *Simulator) metaRevokePermissions(w http.ResponseWriter, r *http.Request) {
+	me, _ := s.authenticate(w, r, "meta")
+	if me == nil {
+		return
+	}
+
+	s.mu.Lock()
+	for _, g := range s.access {
+		if g.platform == "meta" && g.userID == me.ID {
+			s.revokeGrant(g.id)
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// metaPermissions lists the permissions the user granted and declined at login
+func (s *Simulator) metaPermissions(w http.ResponseWriter, r *http.Request) {
+	me, g := s.authenticate(w, r, "meta")
+	if me == nil {
+		return
+	}
+
+	permissions := []map[string]string{}
+	for _, scope := range g.scopes {
+		permissions = append(permissions, map[string]string{"permission": scope, "status": "granted"})
+	}
+	for _, scope := range me.Declined {
+		permissions = append(permissions, map[string]string{"permission": scope, "status": "declined"})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": permissions})
+}
+
+// metaLikes looks a Page up in the user's likes, which are the pages and accounts the user follows.
+// Without user_likes the likes are empty, as they are on the Graph API.
+func (s *Simulator) metaLikes(w http.ResponseWriter, r *http.Request) {
+	me, g := s.authenticate(w, r, "meta")
+	if me == nil {
+		return
+	}
+
+	likes := []map[string]string{}
+	if slices.Contains(g.scopes, "user_likes") {
+		for i, page := range s.follows(me) {
+			if page.ID == r.PathValue("page") {
+				likes = append(likes, map[string]string{
+					"id":           page.ID,
+					"name":         page.Name,
+					"created_time": time.Date(2024, 3, 1+i, 0, 0, 0, 0, time.UTC).Format("2006-01-02T15:04:05-0700"),
+				})
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": likes})
+}
+
+// instagramID returns the ID of a user's Instagram professional account
+func instagramID(user *User) string {
+	return fmt.Sprintf("178414%011s", user.ID)
+}
+
+// findInstagramAccount looks the owner of an Instagram account up by account ID
+func (s *Simulator) findInstagramAccount(id string) *User {
+	for i := range s.users {
+		if instagramID(&s.users[i]) == id {
+			return &s.users[i]
+		}
+	}
+	return nil
+}
+
+// metaPages lists the user's Facebook Page with the Instagram professional account linked to it.
+// Without pages_show_list the list is empty, as it is on the Graph API.
+func (s *Simulator) metaPages(w http.ResponseWriter, r *http.Request) {
+	me, g := s.authenticate(w, r, "meta")
+	if me == nil {
+		return
+	}
+
+	pages := []map[string]any{}
+	if slices.Contains(g.scopes, "pages_show_list") {
+		pages = append(pages, map[string]any{
+			"id":                         "page-" + me.ID,
+			"instagram_business_account": map[string]string{"id": instagramID(me), "username": me.Username},
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": pages, "paging": map[string]any{}})
+}
+
+// businessDiscoveryField matches the business discovery field and captures the requested username
+var businessDiscoveryField = regexp.MustCompile(`business_discovery\.username\(([^)]*)\)`)
+
+// metaObject looks a Graph API node up by ID or username: a user or Page, or the user's own
+// Instagram account, which can look up other professional accounts with business_discovery in fields
+func (s *Simulator) metaObject(w http.ResponseWriter, r *http.Request) {
+	me, _ := s.authenticate(w, r, "meta")
+	if me == nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id != instagramID(me) {
+		s.metaNode(w, id)
+		return
+	}
+
+	body := map[string]any{"id": id, "username": me.Username}
+	if match := businessDiscoveryField.FindStringSubmatch(r.URL.Query().Get("fields")); match != nil {
+		var target *User
+		for i := range s.users {
+			if strings.EqualFold(s.users[i].Username, match[1]) {
+				target = &s.users[i]
+			}
+		}
+		if target == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"error": map[string]any{"message": "Invalid user id", "type": "OAuthException", "code": 110, "error_subcode": 2207013},
+			})
+			return
+		}
+		body = map[string]any{
+			"id":                 id,
+			"business_discovery": map[string]string{"id": instagramID(target), "username": target.Username},
+		}
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// metaNode writes a user or Page found by ID or username. Pages the scenario only names are
+// their own ID and name.
+func (s *Simulator) metaNode(w http.ResponseWriter, key string) {
+	if user := s.findUser(key); user != nil {
+		writeJSON(w, http.StatusOK, map[string]string{"id": user.ID, "name": user.Name})
+		return
+	}
+	for i := range s.users {
+		if slices.Contains(s.users[i].Follows, key) {
+			writeJSON(w, http.StatusOK, map[string]string{"id": key, "name": key})
+			return
+		}
+	}
+	writeMetaError(w, http.StatusNotFound, 803, "Some of the aliases you requested do not exist: "+key)
+}
+
+// instagramMedia lists the posts of the user's Instagram account, newest first, with cursor paging
+func (s *Simulator) instagramMedia(w http.ResponseWriter, r *http.Request) {
+	me, _ := s.authenticate(w, r, "meta")
+	if me == nil {
+		return
+	}
+
+	owner := s.findInstagramAccount(r.PathValue("id"))
+	if owner != me {
+		writeMetaError(w, http.StatusBadRequest, 10, "Application does not have permission for this action")
+		return
+	}
+
+	type media struct {
+		ID        string `json:"id"`
+		Caption   string `json:"caption"`
+		Permalink string `json:"permalink"`
+		Timestamp string `json:"timestamp"`
+	}
+	items := []media{}
+	for i := len(owner.Posts) - 1; i >= 0; i-- {
+		id := fmt.Sprintf("%s%04d", instagramID(owner), i)
+		items = append(items, media{
+			ID:        id,
+			Caption:   owner.Posts[i],
+			Permalink: "https://www.instagram.com/p/" + id + "/",
+			Timestamp: time.Date(2024, 2, 1+i, 12, 0, 0, 0, time.UTC).Format("2006-01-02T15:04:05-0700"),
+		})
+	}
+
+	query := r.URL.Query()
+	page, next := paginate(items, query.Get("after"), s.pageSizeFor(query.Get("limit"), 25, 100))
+	paging := map[string]any{}
+	if next != "" {
+		paging["cursors"] = map[string]string{"after": next}
+		paging["next"] = nextURL(r, "after", next)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": page, "paging": paging})
+}
+
+// discordAuthorization describes the current authorization
+func (s *Simulator) discordAuthorization(w http.ResponseWriter, r *http.Request) {
+	me, g := s.authenticate(w, r, "discord")
+	if me == nil {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"application": map[string]string{"id": g.clientID},
+		"scopes":      g.scopes,
+		"expires":     g.expiry.UTC().Format(time.RFC3339),
+		"user":        discordUser(me),
+	})
+}
+
+// discordUser returns the authenticated user
+func (s *Simulator) discordUser(w http.ResponseWriter, r *http.Request) {
+	me, _ := s.authenticate(w, r, "discord")
+	if me == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, discordUser(me))
+}
+
+// discordGuilds lists the guilds the authenticated user has joined, which needs the guilds scope
+func (s *Simulator) discordGuilds(w http.ResponseWriter, r *http.Request) {
+	me, g := s.authenticate(w, r, "discord")
+	if me == nil {
+		return
+	}
+	if !slices.Contains(g.scopes, "guilds") {
+		writePlatformError(w, "discord", http.StatusForbidden, "Missing Access", 0)
+		return
+	}
+
+	guilds := []map[string]any{}
+	for _, id := range me.Guilds {
+		guilds = append(guilds, map[string]any{"id": id, "name": "Sandbox guild " + id, "owner": false, "permissions": "0"})
+	}
+	writeJSON(w, http.StatusOK, guilds)
+}
+
+// discordMember returns the authenticated user's member object in a guild, which needs the
+// guilds.members.read scope
+func (s *Simulator) discordMember(w http.ResponseWriter, r *http.Request) {
+	me, g := s.authenticate(w, r, "discord")
+	if me == nil {
+		return
+	}
+	if !slices.Contains(g.scopes, "guilds.members.read") {
+		writePlatformError(w, "discord", http.StatusForbidden, "Missing Access", 0)
+		return
+	}
+	if !slices.Contains(me.Guilds, r.PathValue("guild")) {
+		writeJSON(w, http.StatusNotFound, map[string]any{"message": "Unknown Guild", "code": 10004})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, discordMember(me))
+}
+
+// discordGuildMembers lists a guild's members in ascending ID order to a bot
+func (s *Simulator) discordGuildMembers(w http.ResponseWriter, r *http.Request) {
+	if !authenticateBot(w, r) {
+		return
+	}
+	guild := r.PathValue("guild")
+	if !s.guildExists(guild) {
+		writeJSON(w, http.StatusNotFound, map[string]any{"message": "Unknown Guild", "code": 10004})
+		return
+	}
+
+	var members []*User
+	for i := range s.users {
+		if slices.Contains(s.users[i].Guilds, guild) {
+			members = append(members, &s.users[i])
+		}
+	}
+	slices.SortFunc(members, func(a, b *User) int {
+		return cmp.Or(cmp.Compare(len(a.ID), len(b.ID)), cmp.Compare(a.ID, b.ID))
+	})
+
+	// Discord fills every page up to the limit, which clients rely on to find the last page, so the
+	// scenario's page size does not apply
+	query := r.URL.Query()
+	limit := 1
+	if n, err := strconv.Atoi(query.Get("limit")); err == nil && n > 0 {
+		limit = min(n, 1000)
+	}
+
+	after := query.Get("after")
+	page := []map[string]any{}
+	for _, member := range members {
+		if after != "" && (len(member.ID) < len(after) || len(member.ID) == len(after) && member.ID <= after) {
+			continue
+		}
+		if len(page) == limit {
+			break
+		}
+		page = append(page, discordMember(member))
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// discordGuildMember returns a user's member object in a guild to a bot
+func (s *Simulator) discordGuildMember(w http.ResponseWriter, r *http.Request) {
+	if !authenticateBot(w, r) {
+		return
+	}
+	guild := r.PathValue("guild")
+	if !s.guildExists(guild) {
+		writeJSON(w, http.StatusNotFound, map[string]any{"message": "Unknown Guild", "code": 10004})
+		return
+	}
+
+	user := s.findUser(r.PathValue("user"))
+	if user == nil || user.ID != r.PathValue("user") || !slices.Contains(user.Guilds, guild) {
+		writeJSON(w, http.StatusNotFound, map[string]any{"message": "Unknown Member", "code": 10007})
+		return
+	}
+	writeJSON(w, http.StatusOK, discordMember(user))
+}
+
+// authenticateBot accepts any bot token. It writes an unauthorized error and returns false for
+// requests without one.
+func authenticateBot(w http.ResponseWriter, r *http.Request) bool {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bot "); !ok || token == "" {
+		writePlatformError(w, "discord", http.StatusUnauthorized, "401: Unauthorized", 0)
+		return false
+	}
+	return true
+}
+
+// guildExists reports whether any scripted user has joined a guild
+func (s *Simulator) guildExists(guild string) bool {
+	for _, user := range s.users {
+		if slices.Contains(user.Guilds, guild) {
+			return true
+		}
+	}
+	return false
+}
+
+// discordMember returns a user's member object in Discord's format, the same in every joined guild
+func discordMember(user *User) map[string]any {
+	joinedAt := user.JoinedAt
+	if joinedAt.IsZero() {
+		joinedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	roles := user.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	var premiumSince any
+	if user.Boosting {
+		premiumSince = joinedAt.AddDate(0, 1, 0).Format(time.RFC3339)
+	}
+	return map[string]any{
+		"user":          discordUser(user),
+		"nick":          user.Name,
+		"roles":         roles,
+		"joined_at":     joinedAt.Format(time.RFC3339),
+		"premium_since": premiumSince,
+		"deaf":          false,
+		"mute":          false,
+	}
+}
+
+// discordUser returns a user in Discord's format
+func discordUser(user *User) map[string]string {
+	return map[string]string{"id": user.ID, "username": user.Username, "global_name": user.Name, "discriminator": "0"}
+}
+
+// twitterMe returns the authenticated user
+func (s *Simulator) twitterMe(w http.ResponseWriter, r *http.Request) {
+	me, _ := s.authenticate(w, r, "twitter")
+	if me == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": account{me.ID, me.Name, me.Username}})
+}
+
+// twitterUserByUsername looks a user up, reporting unknown users in the errors of a 200 response as Twitter does
+func (s *Simulator) twitterUserByUsername(w http.ResponseWriter, r *http.Request) {
+	if me, _ := s.authenticate(w, r, "twitter"); me == nil {
+		return
+	}
+
+	username := r.PathValue("username")
+	user := s.findUser(username)
+	if user == nil || user.Username != username {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"errors": []map[string]string{{
+				"value":  username,
+				"detail": "Could not find user with username: [" + username + "].",
+				"title":  "Not Found Error",
+				"type":   "https://api.twitter.com/2/problems/resource-not-found",
+			}},
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": account{user.ID, user.Name, user.Username}})
+}
+
+// twitterFollowing lists the accounts a user follows with token pagination
+func (s *Simulator) twitterFollowing(w http.ResponseWriter, r *http.Request) {
+	me, _ := s.authenticate(w, r, "twitter")
+	if me == nil {
+		return
+	}
+
+	user := s.findUser(r.PathValue("id"))
+	if user == nil {
+		writePlatformError(w, "twitter", http.StatusNotFound, "Could not find user with id: ["+r.PathValue("id")+"].", 0)
+		return
+	}
+	if user != me && user.PrivateFollowing {
+		writePlatformError(w, "twitter", http.StatusForbidden, "Sorry, you are not authorized to see this user's following.", 0)
+		return
+	}
+
+	query := r.URL.Query()
+	page, next := paginate(s.follows(user), query.Get("pagination_token"), s.pageSizeFor(query.Get("max_results"), 100, 1000))
+	meta := map[string]any{"result_count": len(page)}
+	if next != "" {
+		meta["next_token"] = next
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": page, "meta": meta})
+}
+
+// tiktokOpenID returns a user's TikTok open ID
+func tiktokOpenID(user *User) string {
+	return "tt-" + user.ID
+}
+
+// tiktokUserInfo returns the requested fields of the authenticated user. The Display API has no
+// endpoint that lists followed accounts, so neither does the simulator.
+func (s *Simulator) tiktokUserInfo(w http.ResponseWriter, r *http.Request) {
+	me, g := s.authenticate(w, r, "tiktok")
+	if me == nil {
+		return
+	}
+
+	fields := strings.Split(r.URL.Query().Get("fields"), ",")
+	if slices.Contains(fields, "username") && !slices.Contains(g.scopes, "user.info.profile") {
+		writeTiktokError(w, http.StatusUnauthorized, "scope_not_authorized", "The user did not authorize the scope required for completing this request.")
+		return
+	}
+
+	available := map[string]string{
+		"open_id":      tiktokOpenID(me),
+		"union_id":     "union-" + me.ID,
+		"display_name": me.Name,
+		"username":     me.Username,
+	}
+	user := map[string]string{}
+	for _, field := range fields {
+		if value, ok := available[field]; ok {
+			user[field] = value
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data":  map[string]any{"user": user},
+		"error": map[string]string{"code": "ok", "message": "", "log_id": randomToken("log")},
+	})
+}
@@ -0,0 +1,145 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Scenario describes the users, follow graph and injected faults served by the simulator
+type Scenario struct {
+	Users    []User   `json:"users"`
+	Faults   []Fault  `json:"faults,omitempty"`
+	PageSize int      `json:"pageSize,omitempty"` // items per page of list endpoints but Discord's member list, the platform's default when unset
+	TokenTTL Duration `json:"tokenTTL,omitempty"` // lifetime of issued access tokens, one hour when unset
+}
+
+// User is a scripted account that exists on every simulated platform
+type User struct {
+	ID               string    `json:"id"`
+	Username         string    `json:"username"`
+	Name             string    `json:"name,omitempty"`
+	ChannelID        string    `json:"channelId,omitempty"`        // YouTube channel, "UC" followed by the zero-padded ID when unset
+	Videos           []string  `json:"videos,omitempty"`           // IDs of uploaded YouTube videos
+	Posts            []string  `json:"posts,omitempty"`            // captions of Instagram posts, oldest first
+	Follows          []string  `json:"follows,omitempty"`          // usernames or IDs of followed accounts and pages
+	Subscriptions    []string  `json:"subscriptions,omitempty"`    // usernames or channel IDs of subscribed YouTube channels
+	Guilds           []string  `json:"guilds,omitempty"`           // IDs of joined Discord guilds
+	Roles            []string  `json:"roles,omitempty"`            // Discord role IDs held in every joined guild
+	JoinedAt         time.Time `json:"joinedAt,omitempty"`         // when the user joined the Discord guilds, 2024-01-01 when unset
+	Boosting         bool      `json:"boosting,omitempty"`         // the user boosts every joined guild
+	Declined         []string  `json:"declined,omitempty"`         // scopes the user declines when logging in
+	PrivateFollowing bool      `json:"privateFollowing,omitempty"` // other users may not list the accounts this user follows
+}
+
+// Fault makes matching simulated API requests slow or fail
+type Fault struct {
+	Platform   string   `json:"platform,omitempty"`   // google, meta, discord, twitter or tiktok, any when unset
+	Path       string   `json:"path,omitempty"`       // path prefix below the platform, such as /2/users, any when unset
+	Status     int      `json:"status,omitempty"`     // error status to respond with, none when unset
+	Latency    Duration `json:"latency,omitempty"`    // delay before the request is handled
+	Rate       float64  `json:"rate,omitempty"`       // share of matching requests affected, all when unset
+	RetryAfter int      `json:"retryAfter,omitempty"` // seconds announced with a 429, one when unset
+	Count      int      `json:"count,omitempty"`      // number of requests affected before the fault expires, unlimited when unset
+}
+
+// Duration is a time.Duration written as a Go duration string such as "250ms" in scenario files
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string such as \"250ms\": %w", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// DefaultScenario returns the built-in scenario: alice follows bob, is subscribed to his channel and
+// has joined and boosts the sandbox guild, where she holds a role, bob follows nobody, and carol keeps
+// the accounts she follows private
+func DefaultScenario() *Scenario {
+	return &Scenario{
+		Users: []User{
+			{
+				ID:            "1001",
+				Username:      "alice",
+				Name:          "Alice Sandbox",
+				Follows:       []string{"bob"},
+				Subscriptions: []string{"bob"},
+				Guilds:        []string{"900000000000000001"},
+				Roles:         []string{"910000000000000001"},
+				Boosting:      true,
+				Posts:         []string{"Unboxing the new drop from @bob today", "Weekend hike"},
+			},
+			{
+				ID:        "1002",
+				Username:  "bob",
+				Name:      "Bob Sandbox",
+				ChannelID: "UCsandboxChannel00000001",
+				Videos:    []string{"sandboxVid1"},
+			},
+			{
+				ID:               "1003",
+				Username:         "carol",
+				Name:             "Carol Sandbox",
+				Follows:          []string{"alice", "bob"},
+				Subscriptions:    []string{"bob"},
+				Guilds:           []string{"900000000000000001"},
+				Declined:         []string{"user_likes"},
+				PrivateFollowing: true,
+			},
+		},
+	}
+}
+
+// LoadScenario reads a scenario from a JSON file, or returns the built-in scenario when path is empty
+func LoadScenario(path string) (*Scenario, error) {
+	if path == "" {
+		return DefaultScenario(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sandbox scenario: %w", err)
+	}
+
+	var scenario Scenario
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return nil, fmt.Errorf("failed to parse sandbox scenario %s: %w", path, err)
+	}
+	if err := scenario.validate(); err != nil {
+		return nil, fmt.Errorf("invalid sandbox scenario %s: %w", path, err)
+	}
+	return &scenario, nil
+}
+
+// validate checks that every user can be told apart by ID and username
+func (s *Scenario) validate() error {
+	if len(s.Users) == 0 {
+		return fmt.Errorf("no users")
+	}
+
+	seen := make(map[string]bool)
+	for _, user := range s.Users {
+		if user.ID == "" || user.Username == "" {
+			return fmt.Errorf("every user needs an id and a username")
+		}
+		for _, key := range []string{"id:" + user.ID, "username:" + user.Username} {
+			if seen[key] {
+				return fmt.Errorf("duplicate user %s", key)
+			}
+			seen[key] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScenario writes a scenario file into a temporary directory and returns its path
+func writeScenario(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestLoadScenario(t *testing.T) {
+	path := writeScenario(t, `{
+		"pageSize": 2,
+		"tokenTTL": "10m",
+		"users": [
+			{ "id": "1001", "username": "alice", "follows": ["bob"], "joinedAt": "2024-03-01T00:00:00Z" },
+			{ "id": "1002", "username": "bob" }
+		],
+		"faults": [
+			{ "platform": "twitter", "path": "/2/users", "status": 503, "latency": "250ms", "count": 2 }
+		]
+	}`)
+
+	scenario, err := LoadScenario(path)
+	if err != nil {
+		t.Fatalf("LoadScenario: %v", err)
+	}
+	if len(scenario.Users) != 2 || scenario.Users[0].Follows[0] != "bob" {
+		t.Errorf("Users = %+v, want alice following bob and bob", scenario.Users)
+	}
+	if want := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC); !scenario.Users[0].JoinedAt.Equal(want) {
+		t.Errorf("JoinedAt = %s, want %s", scenario.Users[0].JoinedAt, want)
+	}
+	if scenario.PageSize != 2 || time.Duration(scenario.TokenTTL) != 10*time.Minute {
+		t.Errorf("PageSize, TokenTTL = %d, %s, want 2, 10m", scenario.PageSize, time.Duration(scenario.TokenTTL))
+	}
+	want := Fault{Platform: "twitter", Path: "/2/users", Status: 503, Latency: Duration(250 * time.Millisecond), Count: 2}
+	if len(scenario.Faults) != 1 || scenario.Faults[0] != want {
+		t.Errorf("Faults = %+v, want %+v", scenario.Faults, want)
+	}
+}
+
+func TestLoadScenarioDefault(t *testing.T) {
+	scenario, err := LoadScenario("")
+	if err != nil {
+		t.Fatalf("LoadScenario: %v", err)
+	}
+	if len(scenario.Users) == 0 {
+		t.Fatal("the built-in scenario has no users")
+	}
+	if err := scenario.validate(); err != nil {
+		t.Errorf("the built-in scenario is invalid: %v", err)
+	}
+}
+
+func TestLoadScenarioErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"not JSON", `users: []`, "failed to parse"},
+		{"duration as a number", `{"tokenTTL": 600, "users": [{"id": "1", "username": "a"}]}`, "duration must be a string"},
+		{"malformed duration", `{"tokenTTL": "ten minutes", "users": [{"id": "1", "username": "a"}]}`, "invalid duration"},
+		{"no users", `{"users": []}`, "no users"},
+		{"user without an ID", `{"users": [{"username": "a"}]}`, "needs an id and a username"},
+		{"user without a username", `{"users": [{"id": "1"}]}`, "needs an id and a username"},
+		{"duplicate ID", `{"users": [{"id": "1", "username": "a"}, {"id": "1", "username": "b"}]}`, "duplicate user id:1"},
+		{"duplicate username", `{"users": [{"id": "1", "username": "a"}, {"id": "2", "username": "a"}]}`, "duplicate user username:a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadScenario(writeScenario(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadScenario = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadScenario(filepath.Join(t.TempDir(), "missing.json")); err == nil || !strings.Contains(err.Error(), "failed to read") {
+		t.Errorf("LoadScenario of a missing file = %v, want a read error", err)
+	}
+}
@@ -0,0 +1,598 @@
+// Package sandbox serves simulated Google, Meta, Discord, Twitter and TikTok APIs in-process,
+// so the service can be run and demonstrated without real platform accounts
+package sandbox
+
+import (
+	"cmp"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// grant is an authorization a scripted user gave to a client
+type grant struct {
+	id            string
+	platform      string
+	userID        string
+	clientID      string
+	redirectURI   string
+	scopes        []string
+	challenge     string
+	challengeType string
+	expiry        time.Time // expiry of the access token
+}
+
+// Simulator serves the simulated platform APIs of a scenario
+type Simulator struct {
+	users    []User
+	pageSize int
+	tokenTTL time.Duration
+
+	mu      sync.Mutex
+	faults  []Fault
+	codes   map[string]*grant
+	access  map[string]*grant
+	refresh map[string]*grant
+}
+
+// New creates a simulator for a scenario
+func New(scenario *Scenario) *Simulator {
+	ttl := time.Duration(scenario.TokenTTL)
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	return &Simulator{
+		users:    scenario.Users,
+		pageSize: scenario.PageSize,
+		tokenTTL: ttl,
+		faults:   append([]Fault(nil), scenario.Faults...),
+		codes:    make(map[string]*grant),
+		access:   make(map[string]*grant),
+		refresh:  make(map[string]*grant),
+	}
+}
+
+// Handler returns the simulated APIs, each below its platform's path prefix,
+// such as /google/token or /twitter/2/users/me
+func (s *Simulator) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /faults", s.listFaults)
+	mux.HandleFunc("POST /faults", s.addFaults)
+	mux.HandleFunc("DELETE /faults", s.clearFaults)
+
+	s.registerOAuth(mux, "google", "/o/oauth2/auth", "/token", "/revoke")
+	s.registerOAuth(mux, "meta", "/dialog/oauth", "/oauth/access_token", "")
+	s.registerOAuth(mux, "discord", "/oauth2/authorize", "/oauth2/token", "/oauth2/token/revoke")
+	s.registerOAuth(mux, "twitter", "/i/oauth2/authorize", "/2/oauth2/token", "/2/oauth2/revoke")
+	s.registerOAuth(mux, "tiktok", "/v2/auth/authorize/", "/v2/oauth/token/", "/v2/oauth/revoke/")
+	s.registerAPIs(mux)
+
+	return s.injectFaults(mux)
+}
+
+// registerOAuth adds a platform's authorization, token and revocation endpoints
+func (s *Simulator) registerOAuth(mux *http.ServeMux, platform, authorizePath, tokenPath, revokePath string) {
+	mux.HandleFunc("GET /"+platform+authorizePath, func(w http.ResponseWriter, r *http.Request) {
+		s.authorize(w, r, platform)
+	})
+	mux.HandleFunc("POST /"+platform+tokenPath, func(w http.ResponseWriter, r *http.Request) {
+		s.token(w, r, platform)
+	})
+	if revokePath != "" {
+		mux.HandleFunc("POST /"+platform+revokePath, func(w http.ResponseWriter, r *http.Request) {
+			s.revoke(w, r, platform)
+		})
+	}
+}
+
+// authorizeTemplate is the consent screen that lets the developer pick a scripted user
+var authorizeTemplate = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html><head><title>Sandbox {{.Platform}} login</title></head>
+<body>
+<h1>Sandbox {{.Platform}} login</h1>
+<p>{{.ClientID}} asks for: {{.Scope}}</p>
+<ul>
+{{range .Users}}<li><a href="{{.Link}}">Continue as {{.Username}}</a></li>
+{{end}}</ul>
+<p><a href="{{.DenyLink}}">Deny</a></p>
+</body></html>
+`))
+
+// authorize shows the consent screen, or approves or denies right away when the request picks
+// a user with sandbox_user or sets sandbox_deny, which lets scripts log in without a browser
+func (s *Simulator) authorize(w http.ResponseWriter, r *http.Request, platform string) {
+	query := r.URL.Query()
+	redirectURI := query.Get("redirect_uri")
+	callback, err := url.Parse(redirectURI)
+	if err != nil || redirectURI == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("sandbox_deny") != "" {
+		values := callback.Query()
+		values.Set("error", "access_denied")
+		values.Set("state", query.Get("state"))
+		callback.RawQuery = values.Encode()
+		http.Redirect(w, r, callback.String(), http.StatusFound)
+		return
+	}
+
+	username := query.Get("sandbox_user")
+	if username == "" {
+		s.renderConsent(w, r, platform)
+		return
+	}
+
+	user := s.findUser(username)
+	if user == nil {
+		http.Error(w, "unknown sandbox user", http.StatusBadRequest)
+		return
+	}
+
+	code := randomToken("code")
+	s.mu.Lock()
+	s.codes[code] = &grant{
+		platform:      platform,
+		userID:        user.ID,
+		clientID:      cmp.Or(query.Get("client_id"), query.Get("client_key")),
+		redirectURI:   redirectURI,
+		scopes:        grantedScopes(query.Get("scope"), user),
+		challenge:     query.Get("code_challenge"),
+		challengeType: query.Get("code_challenge_method"),
+	}
+	s.mu.Unlock()
+
+	values := callback.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	callback.RawQuery = values.Encode()
+	http.Redirect(w, r, callback.String(), http.StatusFound)
+}
+
+// grantedScopes returns the requested scopes the user does not decline
+func grantedScopes(scope string, user *User) []string {
+	requested := strings.FieldsFunc(scope, func(r rune) bool { return r == ' ' || r == ',' })
+	return slices.DeleteFunc(requested, func(s string) bool { return slices.Contains(user.Declined, s) })
+}
+
+// renderConsent renders the consent screen with a link per scripted user
+func (s *Simulator) renderConsent(w http.ResponseWriter, r *http.Request, platform string) {
+	link := func(key, value string) string {
+		query := r.URL.Query()
+		query.Set(key, value)
+		u := *r.URL
+		u.Path = requestPath(r)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+
+	type userLink struct{ Username, Link string }
+	data := struct {
+		Platform, ClientID, Scope, DenyLink string
+		Users                               []userLink
+	}{
+		Platform: platform,
+		ClientID: cmp.Or(r.URL.Query().Get("client_id"), r.URL.Query().Get("client_key")),
+		Scope:    r.URL.Query().Get("scope"),
+		DenyLink: link("sandbox_deny", "1"),
+	}
+	for _, user := range s.users {
+		data.Users = append(data.Users, userLink{user.Username, link("sandbox_user", user.Username)})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := authorizeTemplate.Execute(w, data); err != nil {
+		log.Printf("Failed to render sandbox consent screen: %v", err)
+	}
+}
+
+// token exchanges an authorization code or a refresh token for a new token pair
+func (s *Simulator) token(w http.ResponseWriter, r *http.Request, platform string) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, "invalid_request")
+		return
+	}
+	// TikTok calls the client ID client_key and rejects requests without it
+	clientID := cmp.Or(r.PostForm.Get("client_id"), r.PostForm.Get("client_key"))
+	if platform == "tiktok" && r.PostForm.Get("client_key") == "" {
+		writeOAuthError(w, "invalid_client")
+		return
+	}
+	if id, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var g *grant
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code := r.PostForm.Get("code")
+		g = s.codes[code]
+		delete(s.codes, code)
+		if g == nil || g.platform != platform || g.redirectURI != r.PostForm.Get("redirect_uri") {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+		if !verifyChallenge(g.challenge, g.challengeType, r.PostForm.Get("code_verifier")) {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+		g.id = randomToken("grant")
+	case "refresh_token":
+		refreshToken := r.PostForm.Get("refresh_token")
+		g = s.refresh[refreshToken]
+		if g == nil || g.platform != platform {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+	default:
+		writeOAuthError(w, "unsupported_grant_type")
+		return
+	}
+	if g.clientID != "" && clientID != "" && g.clientID != clientID {
+		writeOAuthError(w, "invalid_client")
+		return
+	}
+	// Refreshing rotates the token pair
+	s.revokeGrant(g.id)
+
+	accessToken := randomToken(platform)
+	refreshToken := randomToken(platform + "-refresh")
+	issued := *g
+	issued.expiry = time.Now().Add(s.tokenTTL)
+	s.access[accessToken] = &issued
+	s.refresh[refreshToken] = &issued
+
+	body := map[string]any{
+		"access_token":  accessToken,
+		"token_type":    "bearer",
+		"expires_in":    int(s.tokenTTL.Seconds()),
+		"refresh_token": refreshToken,
+		"scope":         strings.Join(issued.scopes, " "),
+	}
+	if platform == "tiktok" {
+		// TikTok separates scopes with commas and names the user in the token response
+		body["scope"] = strings.Join(issued.scopes, ",")
+		body["open_id"] = tiktokOpenID(s.findUser(issued.userID))
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// revoke revokes the whole grant of an access or refresh token, as Google does
+func (s *Simulator) revoke(w http.ResponseWriter, r *http.Request, platform string) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, "invalid_request")
+		return
+	}
+	token := r.Form.Get("token")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.access[token]
+	if g == nil {
+		g = s.refresh[token]
+	}
+	if g == nil || g.platform != platform {
+		// RFC 7009 treats unknown tokens as revoked, Google reports them
+		if platform == "google" {
+			writeOAuthError(w, "invalid_token")
+		}
+		return
+	}
+	s.revokeGrant(g.id)
+}
+
+// revokeGrant drops every token issued for a grant. The caller must hold s.mu.
+func (s *Simulator) revokeGrant(id string) {
+	for token, g := range s.access {
+		if g.id == id {
+			delete(s.access, token)
+		}
+	}
+	for token, g := range s.refresh {
+		if g.id == id {
+			delete(s.refresh, token)
+		}
+	}
+}
+
+// authenticate returns the user and grant of the request's bearer token, or writes the platform's
+// invalid token error and returns nil
+func (s *Simulator) authenticate(w http.ResponseWriter, r *http.Request, platform string) (*User, *grant) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("access_token")
+	}
+
+	g := s.lookupToken(token, platform)
+	if g == nil {
+		writePlatformError(w, platform, http.StatusUnauthorized, "invalid or expired access token", 0)
+		return nil, nil
+	}
+	return s.findUser(g.userID), g
+}
+
+// lookupToken returns the unexpired grant of an access token issued by platform
+func (s *Simulator) lookupToken(token, platform string) *grant {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.access[token]
+	if g == nil || g.platform != platform || time.Now().After(g.expiry) {
+		return nil
+	}
+	return g
+}
+
+// findUser looks a scripted user up by ID or username
+func (s *Simulator) findUser(key string) *User {
+	for i := range s.users {
+		if s.users[i].ID == key || s.users[i].Username == key {
+			return &s.users[i]
+		}
+	}
+	return nil
+}
+
+// listFaults returns the active faults
+func (s *Simulator) listFaults(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	faults := append([]Fault{}, s.faults...)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, faults)
+}
+
+// addFaults adds the faults in the request body to the active ones
+func (s *Simulator) addFaults(w http.ResponseWriter, r *http.Request) {
+	var faults []Fault
+	if err := json.NewDecoder(r.Body).Decode(&faults); err != nil {
+		http.Error(w, "expected a JSON array of faults: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.faults = append(s.faults, faults...)
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clearFaults removes every active fault
+func (s *Simulator) clearFaults(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	s.faults = nil
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// injectFaults delays or fails requests that match an active fault
+func (s *Simulator) injectFaults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		platform, path, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if platform == "faults" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		fault, ok := s.matchFault(platform, "/"+path)
+		if ok && fault.Latency > 0 {
+			select {
+			case <-time.After(time.Duration(fault.Latency)):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if ok && fault.Status != 0 {
+			writePlatformError(w, platform, fault.Status, "injected sandbox fault", fault.RetryAfter)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// matchFault returns the first active fault that applies to a request, using up one of its count
+func (s *Simulator) matchFault(platform, path string) (Fault, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.faults {
+		fault := &s.faults[i]
+		if fault.Platform != "" && fault.Platform != platform {
+			continue
+		}
+		if !strings.HasPrefix(path, fault.Path) {
+			continue
+		}
+		if fault.Rate > 0 && rand.Float64() >= fault.Rate {
+			continue
+		}
+
+		matched := *fault
+		if fault.Count > 0 {
+			fault.Count--
+			if fault.Count == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return matched, true
+	}
+	return Fault{}, false
+}
+
+// writePlatformError writes an error in the platform's response format, with the rate limit headers
+// the platform sends along with a 429
+func writePlatformError(w http.ResponseWriter, platform string, status int, message string, retryAfter int) {
+	if status == http.StatusTooManyRequests {
+		retryAfter = max(retryAfter, 1)
+		w.Header().Set("Retry-After", fmt.Sprint(retryAfter))
+		switch platform {
+		case "twitter":
+			w.Header().Set("X-Rate-Limit-Limit", "15")
+			w.Header().Set("X-Rate-Limit-Remaining", "0")
+			w.Header().Set("X-Rate-Limit-Reset", fmt.Sprint(time.Now().Add(time.Duration(retryAfter)*time.Second).Unix()))
+		case "discord":
+			w.Header().Set("X-RateLimit-Limit", "5")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset-After", fmt.Sprint(retryAfter))
+			w.Header().Set("X-RateLimit-Bucket", "sandbox")
+		case "meta":
+			w.Header().Set("X-App-Usage", `{"call_count":100,"total_time":0,"total_cputime":0}`)
+		}
+	}
+
+	switch platform {
+	case "google":
+		writeGoogleError(w, status, googleReason(status), message)
+	case "meta":
+		writeMetaError(w, status, metaCode(status), message)
+	case "discord":
+		body := map[string]any{"message": message, "code": 0}
+		if status == http.StatusTooManyRequests {
+			body["retry_after"] = retryAfter
+		}
+		writeJSON(w, status, body)
+	case "twitter":
+		writeJSON(w, status, map[string]any{"title": http.StatusText(status), "detail": message, "status": status})
+	case "tiktok":
+		writeTiktokError(w, status, tiktokCode(status), message)
+	default:
+		writeJSON(w, status, map[string]any{"error": map[string]any{"code": status, "message": message}})
+	}
+}
+
+// writeGoogleError writes a Google API error with a reason
+func writeGoogleError(w http.ResponseWriter, status int, reason, message string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{
+			"code":    status,
+			"message": message,
+			"errors":  []map[string]string{{"reason": reason, "message": message}},
+		},
+	})
+}
+
+// writeMetaError writes a Graph API error with an error code
+func writeMetaError(w http.ResponseWriter, status, code int, message string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{"message": message, "type": "OAuthException", "code": code},
+	})
+}
+
+// googleReason returns the Google API error reason for a status
+func googleReason(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return "authError"
+	case status == http.StatusForbidden:
+		return "forbidden"
+	case status == http.StatusNotFound:
+		return "channelNotFound"
+	case status == http.StatusTooManyRequests:
+		return "rateLimitExceeded"
+	case status >= http.StatusInternalServerError:
+		return "backendError"
+	}
+	return "badRequest"
+}
+
+// metaCode returns the Graph API error code for a status
+func metaCode(status int) int {
+	switch {
+	case status == http.StatusUnauthorized:
+		return 190
+	case status == http.StatusForbidden:
+		return 10
+	case status == http.StatusNotFound:
+		return 803
+	case status == http.StatusTooManyRequests:
+		return 4
+	case status >= http.StatusInternalServerError:
+		return 2
+	}
+	return 100
+}
+
+// tiktokCode returns the TikTok API error code for a status
+func tiktokCode(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return "access_token_invalid"
+	case status == http.StatusForbidden:
+		return "scope_not_authorized"
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_exceeded"
+	case status >= http.StatusInternalServerError:
+		return "internal_error"
+	}
+	return "invalid_params"
+}
+
+// writeTiktokError writes a TikTok API error, which comes in the same envelope as the data
+func writeTiktokError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]any{
+		"data":  map[string]any{},
+		"error": map[string]string{"code": code, "message": message, "log_id": randomToken("log")},
+	})
+}
+
+// writeOAuthError writes an RFC 6749 token endpoint error
+func writeOAuthError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to encode sandbox response: %v", err)
+	}
+}
+
+// verifyChallenge checks a PKCE code verifier against the challenge sent with the authorization request
+func verifyChallenge(challenge, method, verifier string) bool {
+	if challenge == "" {
+		return true
+	}
+	if method != "S256" {
+		return verifier == challenge
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:]) == challenge
+}
+
+// randomToken returns an opaque random token with a readable prefix
+func randomToken(prefix string) string {
+	b := make([]byte, 16)
+	if _, err := cryptorand.Read(b); err != nil {
+		panic(err)
+	}
+	return "sbx-" + prefix + "-" + hex.EncodeToString(b)
+}
+
+// requestPath returns the path the client requested, including the prefix the simulator is mounted under
+func requestPath(r *http.Request) string {
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		return u.Path
+	}
+	return r.URL.Path
+}
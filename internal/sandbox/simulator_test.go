@@ -0,0 +1,121 @@
+package sandbox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchFault(t *testing.T) {
+	s := New(&Scenario{Faults: []Fault{
+		{Platform: "twitter", Path: "/2/users/by", Status: 429},
+		{Platform: "discord", Status: 503},
+		{Path: "/token", Status: 500},
+	}})
+
+	tests := []struct {
+		platform, path string
+		wantStatus     int // zero when no fault applies
+	}{
+		{"twitter", "/2/users/by/username/bob", 429},
+		{"twitter", "/2/users/me", 0},
+		{"twitter", "/2/oauth2/token", 0},
+		{"discord", "/users/@me", 503},
+		{"discord", "/token", 503},
+		{"google", "/token", 500},
+		{"google", "/youtube/v3/subscriptions", 0},
+	}
+	for _, tt := range tests {
+		fault, ok := s.matchFault(tt.platform, tt.path)
+		if ok != (tt.wantStatus != 0) || fault.Status != tt.wantStatus {
+			t.Errorf("matchFault(%s, %s) = %d, %v, want %d", tt.platform, tt.path, fault.Status, ok, tt.wantStatus)
+		}
+	}
+}
+
+func TestMatchFaultCount(t *testing.T) {
+	s := New(&Scenario{Faults: []Fault{
+		{Platform: "meta", Status: 500, Count: 2},
+		{Platform: "meta", Status: 503},
+	}})
+
+	// The counted fault comes first until it is used up, then the next matching fault applies
+	for i, want := range []int{500, 500, 503, 503} {
+		fault, ok := s.matchFault("meta", "/me")
+		if !ok || fault.Status != want {
+			t.Errorf("request %d got fault %+v, %v, want status %d", i+1, fault, ok, want)
+		}
+	}
+	if len(s.faults) != 1 {
+		t.Errorf("%d faults remain active, want 1", len(s.faults))
+	}
+}
+
+func TestMatchFaultRate(t *testing.T) {
+	s := New(&Scenario{Faults: []Fault{
+		{Platform: "tiktok", Status: 500, Rate: 1e-9},
+		{Platform: "google", Status: 500, Rate: 1},
+	}})
+
+	for range 100 {
+		if _, ok := s.matchFault("tiktok", "/v2/user/info/"); ok {
+			t.Fatal("a fault with a rate of one in a billion matched")
+		}
+		if _, ok := s.matchFault("google", "/token"); !ok {
+			t.Fatal("a fault with a rate of 1 did not match")
+		}
+	}
+}
+
+func TestInjectFaults(t *testing.T) {
+	s := New(&Scenario{
+		Users: DefaultScenario().Users,
+		Faults: []Fault{
+			{Platform: "twitter", Path: "/2/users/me", Status: 429, RetryAfter: 30, Count: 1},
+			{Platform: "discord", Latency: Duration(50 * time.Millisecond), Count: 1},
+		},
+	})
+	handler := s.Handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/twitter/2/users/me", nil))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" || w.Header().Get("X-Rate-Limit-Remaining") != "0" {
+		t.Errorf("faulted request = %d %v, want a 429 with Twitter's rate limit headers", w.Code, w.Header())
+	}
+
+	// The fault is used up, so the request reaches the simulated API, which wants a token
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/twitter/2/users/me", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("request after the fault expired = %d, want 401", w.Code)
+	}
+
+	started := time.Now()
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/discord/users/@me", nil))
+	if waited := time.Since(started); waited < 50*time.Millisecond {
+		t.Errorf("request with injected latency took %s, want at least 50ms", waited)
+	}
+	if w.Code == http.StatusServiceUnavailable || strings.Contains(w.Body.String(), "injected") {
+		t.Errorf("latency-only fault failed the request: %d %s", w.Code, w.Body)
+	}
+
+	// Faults can be managed at runtime
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/faults", strings.NewReader(`[{"platform":"google","status":503}]`)))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("adding a fault = %d %s, want 204", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/google/youtube/v3/subscriptions", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("request after adding a fault = %d, want 503", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("DELETE", "/faults", nil))
+	if _, ok := s.matchFault("google", "/token"); ok {
+		t.Error("a fault is still active after clearing them")
+	}
+}
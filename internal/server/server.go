@@ -1,9 +1,15 @@
 package server
 
 import (
+	"context"
+	"fmt"
+	"hej/internal/auth"
 	"hej/internal/config"
+	"hej/internal/platform"
 	"hej/internal/router"
+	"hej/internal/sandbox"
 	"log"
+	"net"
 	"net/http"
 	"time"
 )
@@ -15,13 +21,132 @@ type Server struct {
 }
 
 // NewServer creates a new server instance
-func NewServer() *Server {
+func NewServer() (*Server, error) {
 	cfg := config.LoadConfig()
 
+	if cfg.OAuthStateSecret != "" {
+		auth.SetDefaultStateStore(auth.NewStateStore(auth.StateTTL, []byte(cfg.OAuthStateSecret)))
+	}
+
+	backend, err := newTokenBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+	auth.SetDefaultTokenStore(auth.NewTokenStore(backend))
+
+	if err := platform.ConfigureClients(platform.ClientOptions{
+		DialTimeout:           cfg.UpstreamDialTimeout,
+		TLSHandshakeTimeout:   cfg.UpstreamTLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.UpstreamResponseHeaderTimeout,
+		IdleConnTimeout:       cfg.UpstreamIdleConnTimeout,
+		MaxConnsPerHost:       cfg.UpstreamMaxConnsPerHost,
+		MaxIdleConnsPerHost:   cfg.UpstreamMaxIdleConnsPerHost,
+		Timeout:               cfg.UpstreamTimeout,
+		ProxyURL:              cfg.UpstreamProxyURL,
+		CAFile:                cfg.UpstreamCAFile,
+	}); err != nil {
+		return nil, fmt.Errorf("invalid upstream client settings: %w", err)
+	}
+
+	mode := platform.RateLimitMode(cfg.RateLimitMode)
+	if mode != platform.RateLimitWait && mode != platform.RateLimitFail {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_MODE %q, expected wait or fail", cfg.RateLimitMode)
+	}
+	platform.SetDefaultRateLimiter(platform.NewRateLimiter(mode, cfg.RateLimitMaxWait, cfg.RateLimitAppUsageThreshold, nil))
+	platform.SetDefaultRetryPolicy(platform.RetryPolicy{
+		MaxAttempts: max(cfg.RetryMaxAttempts, 1),
+		BaseDelay:   cfg.RetryBaseDelay,
+		MaxDelay:    cfg.RetryMaxDelay,
+	})
+	platform.SetDefaultBreakers(platform.NewBreakers(max(cfg.BreakerFailureThreshold, 1), cfg.BreakerCooldown))
+
+	if match := platform.RoleMatch(cfg.DiscordRoleMatch); match != platform.RoleMatchAny && match != platform.RoleMatchAll {
+		return nil, fmt.Errorf("invalid DISCORD_ROLE_MATCH %q, expected any or all", cfg.DiscordRoleMatch)
+	}
+	if cfg.DiscordMemberSyncInterval > 0 && cfg.DiscordBotToken == "" {
+		return nil, fmt.Errorf("DISCORD_MEMBER_SYNC_INTERVAL is set but DISCORD_BOT_TOKEN is not")
+	}
+
+	if err := resolveYouTubeChannel(cfg); err != nil {
+		return nil, fmt.Errorf("invalid YT_CHANNEL_ID: %w", err)
+	}
+
+	var simulator http.Handler
+	if cfg.SandboxMode {
+		scenario, err := sandbox.LoadScenario(cfg.SandboxScenario)
+		if err != nil {
+			return nil, err
+		}
+		simulator = sandbox.New(scenario).Handler()
+		log.Printf("Sandbox mode: platform APIs are simulated at %s", cfg.SandboxBaseURL)
+	}
+
 	return &Server{
-		router: router.NewRouter(cfg),
+		router: router.NewRouter(cfg, simulator),
 		cfg:    cfg,
+	}, nil
+}
+
+// youTubeResolveTimeout bounds resolving the configured YouTube channel at startup
+const youTubeResolveTimeout = 15 * time.Second
+
+// resolveYouTubeChannel replaces a configured YouTube handle or URL with the channel ID it refers to,
+// so a typo fails startup instead of every check. The simulated APIs are not served yet in sandbox
+// mode, so there the reference is only validated and checks resolve it.
+func resolveYouTubeChannel(cfg *config.Config) error {
+	if cfg.YouTubeChannelID == "" {
+		return nil
+	}
+	if cfg.SandboxMode {
+		return platform.ValidateChannelRef(cfg.YouTubeChannelID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), youTubeResolveTimeout)
+	defer cancel()
+
+	channelID, err := platform.NewChannelResolver(cfg).Resolve(ctx, cfg.YouTubeChannelID)
+	if err != nil {
+		return err
 	}
+	if channelID != cfg.YouTubeChannelID {
+		log.Printf("YouTube channel %s resolved to %s", cfg.YouTubeChannelID, channelID)
+		cfg.YouTubeChannelID = channelID
+	}
+	return nil
+}
+
+// newTokenBackend creates the token storage backend described by the configuration.
+// Tokens are kept on disk when a store path is set and encrypted when keys are configured.
+func newTokenBackend(cfg *config.Config) (auth.Backend, error) {
+	var backend auth.Backend = auth.NewMemoryBackend()
+	if cfg.TokenStorePath != "" {
+		fileBackend, err := auth.NewFileBackend(cfg.TokenStorePath)
+		if err != nil {
+			return nil, err
+		}
+		backend = fileBackend
+	}
+
+	if cfg.TokenEncryptionKeys != "" {
+		keyring, err := auth.ParseKeyring(cfg.TokenEncryptionKeys, cfg.TokenEncryptionKeyID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token encryption keys: %w", err)
+		}
+
+		// Plaintext records would fail every session lookup, so they have to be encrypted first
+		plaintext, err := auth.CountPlaintext(backend)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token store: %w", err)
+		}
+		if plaintext > 0 {
+			return nil, fmt.Errorf("token store holds %d unencrypted records; run go run ./cmd/rotate-keys to encrypt them before enabling TOKEN_ENCRYPTION_KEYS", plaintext)
+		}
+		backend = auth.NewEncryptedBackend(backend, keyring)
+	} else if cfg.TokenStorePath != "" {
+		log.Println("Warning: TOKEN_ENCRYPTION_KEYS is not set, tokens are stored unencrypted")
+	}
+
+	return backend, nil
 }
 
 // Start initializes and starts the server
@@ -38,6 +163,16 @@ func (s *Server) Start() error {
 		IdleTimeout:  120 * time.Second,
 	}
 
+	// Listen before the member sync starts, since in sandbox mode it reads the simulated APIs served here
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+
+	if s.cfg.DiscordMemberSyncInterval > 0 {
+		platform.StartDiscordMemberSync(context.Background(), s.cfg)
+	}
+
 	log.Printf("Server starting on port %s", s.cfg.Port)
-	return server.ListenAndServe()
+	return server.Serve(listener)
 }